@@ -1,16 +1,17 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 
+	"github.com/Papiermond/gitea-sync/internal/apierror"
 	"github.com/Papiermond/gitea-sync/internal/config"
+	"github.com/Papiermond/gitea-sync/internal/forge"
 	"github.com/Papiermond/gitea-sync/internal/gitea"
-	"github.com/Papiermond/gitea-sync/internal/github"
-	"github.com/Papiermond/gitea-sync/internal/gitlab"
 	"github.com/spf13/cobra"
 )
 
@@ -19,6 +20,9 @@ var (
 	addRepoName    string
 	addUseGitLab   bool
 	addUseGitHub   bool
+	addTargets     []string
+	addRollback    bool
+	addOwner       string
 )
 
 var addCmd = &cobra.Command{
@@ -29,23 +33,34 @@ var addCmd = &cobra.Command{
 If no path is provided, uses the current directory.
 The repository name is detected from the directory name or can be specified with --name.
 
+A .gitea-sync.yaml in the repository or one of its parent directories sets
+the defaults of the project: the repository name, its visibility, the
+mirror targets and the Gitea organization owning it, e.g.
+
+  name: website
+  visibility: private
+  targets: [github, gitlab]
+  owner: my-team
+
+Flags and environment variables take precedence over the project file,
+which takes precedence over the config file. create and mirror read the
+project file of the current directory.
+
+If a step fails, the repositories and push mirrors created by this run are
+listed and can be deleted; --rollback deletes them without asking. The
+remotes and git config of the local repository are restored as well.
+Repositories that already existed are never deleted. If only some targets
+fail, only what was created for them is offered.
+
 Examples:
   gitea-sync add                       # Add current directory (mirrors to GitHub)
   gitea-sync add ./my-project          # Add specific directory (mirrors to GitHub)
   gitea-sync add --name custom-name    # Add current dir with custom name
-  gitea-sync add --gitlab              # Add and mirror to GitLab instead`,
+  gitea-sync add --gitlab              # Add and mirror to GitLab instead
+  gitea-sync add --target gitlab       # Same as --gitlab
+  gitea-sync add -t github -t gitlab   # Mirror to both GitHub and GitLab`,
 	Args: cobra.MaximumNArgs(1),
-	RunE: func(cmd *cobra.Command, args []string) error {
-		// Validate flags
-		if addUseGitLab && addUseGitHub {
-			return fmt.Errorf("cannot use both -gitlab and -github flags")
-		}
-
-		// Default to GitHub if neither flag is set
-		if !addUseGitLab && !addUseGitHub {
-			addUseGitHub = true
-		}
-
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
 		// Determine the path
 		repoPath := "."
 		if len(args) > 0 {
@@ -63,183 +78,150 @@ Examples:
 			return fmt.Errorf("not a git repository: %s", absPath)
 		}
 
+		// Read the defaults of the project
+		project, err := findProject(absPath)
+		if err != nil {
+			return err
+		}
+		private := project.Private(addPrivateFlag, cmd.Flags().Changed("private"))
+
 		// Determine repo name
 		repoName := addRepoName
+		if repoName == "" {
+			repoName = project.Name
+		}
 		if repoName == "" {
 			repoName = filepath.Base(absPath)
 		}
 
+		// Print the JSON result once the command returns
+		result := &repoResult{Repo: repoName, Path: absPath}
+		var results []*targetResult
+		defer func() {
+			result.setTargets(results, repoName, defaultMirrorOptions)
+			result.emit(err)
+		}()
+
 		// Load config
-		cfg, err := config.Load()
+		cfg, err := loadConfig()
 		if err != nil {
 			return err
 		}
+		project.Apply(cfg)
+		applyOwnerFlag(cmd, cfg, addOwner)
 
-		// Validate configuration based on selected platform
-		if addUseGitLab {
-			if cfg.GitLab.Token == "" || cfg.GitLab.Username == "" {
-				return fmt.Errorf("GitLab credentials not configured. Run 'gitea-sync init' to configure")
-			}
+		// Resolve the mirror targets
+		targets, err := resolveTargets(cfg, addTargets, addUseGitHub, addUseGitLab)
+		if err != nil {
+			return err
 		}
 
-		// Initialize clients
-		giteaClient := gitea.NewClient(cfg.Gitea.URL, cfg.Gitea.Token)
-		var githubClient *github.Client
-		var gitlabClient *gitlab.Client
-
-		if addUseGitHub {
-			githubClient = github.NewClient(cfg.GitHub.Token)
-		} else {
-			gitlabClient = gitlab.NewClient(cfg.GitLab.URL, cfg.GitLab.Token)
+		// Initialize client
+		giteaClient, err := newGiteaClient(cfg)
+		if err != nil {
+			return err
 		}
-
-		fmt.Println("================================================")
-		fmt.Printf("Adding repository: %s\n", repoName)
-		fmt.Printf("Path: %s\n", absPath)
-		fmt.Printf("Privacy setting: %t\n", addPrivateFlag)
-		if addUseGitHub {
-			fmt.Println("Mirror target: GitHub")
-		} else {
-			fmt.Println("Mirror target: GitLab")
+		if err := checkGiteaOwner(cmd.Context(), giteaClient, cfg); err != nil {
+			return err
 		}
-		fmt.Println("================================================")
 
-		// 1. Create on GitHub or GitLab
-		var exists bool
-		if addUseGitHub {
-			fmt.Println("\n1. Checking GitHub...")
-			exists, err = githubClient.RepoExists(cfg.GitHub.Username, repoName)
-			if err != nil {
-				return fmt.Errorf("failed to check GitHub: %w", err)
-			}
+		fmt.Fprintln(out, "================================================")
+		fmt.Fprintf(out, "Adding repository: %s/%s\n", cfg.Gitea.RepoOwner(), repoName)
+		fmt.Fprintf(out, "Path: %s\n", absPath)
+		fmt.Fprintf(out, "Privacy setting: %t\n", private)
+		fmt.Fprintf(out, "Mirror targets: %s\n", targetNames(targets))
+		fmt.Fprintln(out, "================================================")
 
-			if !exists {
-				fmt.Println("  → Creating GitHub repo...")
-				err = githubClient.CreateRepo(github.CreateRepoRequest{
-					Name:     repoName,
-					Private:  addPrivateFlag,
-					AutoInit: false,
-				})
-				if err != nil {
-					return fmt.Errorf("failed to create GitHub repo: %w", err)
-				}
-				fmt.Println("  ✓ GitHub repo created")
-			} else {
-				fmt.Println("  ✓ GitHub repo already exists")
-			}
-		} else {
-			fmt.Println("\n1. Checking GitLab...")
-			exists, err = gitlabClient.RepoExists(cfg.GitLab.Username, repoName)
+		// Offer to delete what this run created if a later step fails
+		var undo rollback
+		defer func() {
 			if err != nil {
-				return fmt.Errorf("failed to check GitLab: %w", err)
-			}
-
-			if !exists {
-				fmt.Println("  → Creating GitLab repo...")
-				visibility := "public"
-				if addPrivateFlag {
-					visibility = "private"
-				}
-				err = gitlabClient.CreateRepo(gitlab.CreateRepoRequest{
-					Name:       repoName,
-					Visibility: visibility,
-				})
-				if err != nil {
-					return fmt.Errorf("failed to create GitLab repo: %w", err)
-				}
-				fmt.Println("  ✓ GitLab repo created")
-			} else {
-				fmt.Println("  ✓ GitLab repo already exists")
+				undo.offer(cmd.Context(), addRollback)
 			}
+		}()
+
+		// 1. Create on the mirror targets
+		fmt.Fprintln(out, "\n1. Checking mirror targets...")
+		results = ensureTargetRepos(cmd.Context(), targets, repoName, private)
+		undo.recordTargetRepos(results, repoName)
+		if len(succeededTargets(results)) == 0 {
+			return targetsError(results)
 		}
 
 		// 2. Create on Gitea
-		fmt.Println("\n2. Checking Gitea...")
-		exists, err = giteaClient.RepoExists(cfg.Gitea.Username, repoName)
+		fmt.Fprintln(out, "\n2. Checking Gitea...")
+		exists, err := giteaClient.RepoExists(cmd.Context(), cfg.Gitea.RepoOwner(), repoName)
 		if err != nil {
-			return fmt.Errorf("failed to check Gitea: %w", err)
+			return fmt.Errorf("failed to check Gitea: %w", withHint(err))
 		}
+		result.URL = giteaWebURL(cfg, repoName)
 
 		if !exists {
-			fmt.Println("  → Creating Gitea repo...")
-			err = giteaClient.CreateRepo(gitea.CreateRepoRequest{
+			fmt.Fprintln(out, "  → Creating Gitea repo...")
+			err = createGiteaRepo(cmd.Context(), giteaClient, cfg, gitea.CreateRepoRequest{
 				Name:     repoName,
-				Private:  addPrivateFlag,
+				Private:  private,
 				AutoInit: false,
 			})
-			if err != nil {
-				return fmt.Errorf("failed to create Gitea repo: %w", err)
+			switch {
+			case apierror.IsConflict(err):
+				// Created since the check, e.g. by a concurrent run
+				exists = true
+			case err != nil:
+				return fmt.Errorf("failed to create Gitea repo: %w", withHint(err))
+			default:
+				fmt.Fprintln(out, "  ✓ Gitea repo created")
+				result.Gitea = stateCreated
+				undo.record(fmt.Sprintf("Gitea repo %s", giteaWebURL(cfg, repoName)), func(ctx context.Context) error {
+					return giteaClient.DeleteRepo(ctx, cfg.Gitea.RepoOwner(), repoName)
+				})
 			}
-			fmt.Println("  ✓ Gitea repo created")
-		} else {
-			fmt.Println("  ✓ Gitea repo already exists")
+		}
+		if exists {
+			fmt.Fprintln(out, "  ✓ Gitea repo already exists")
+			result.Gitea = stateExisted
 		}
 
-		// 3. Set up push mirror
-		if addUseGitHub {
-			fmt.Println("\n3. Setting up GitHub mirror...")
-			err = giteaClient.AddPushMirror(cfg.Gitea.Username, repoName, gitea.PushMirrorRequest{
-				RemoteAddress:  fmt.Sprintf("https://github.com/%s/%s.git", cfg.GitHub.Username, repoName),
-				RemotePassword: cfg.GitHub.Token,
-				RemoteUsername: cfg.GitHub.Username,
-				SyncOnCommit:   true,
-				Interval:       "8h",
-			})
-			if err != nil {
-				return fmt.Errorf("failed to set up mirror: %w", err)
-			}
-			fmt.Println("  ✓ Mirror configured")
-		} else {
-			fmt.Println("\n3. Setting up GitLab mirror...")
-			gitlabURL := cfg.GitLab.URL
-			if gitlabURL == "" {
-				gitlabURL = "https://gitlab.com"
-			}
-			err = giteaClient.AddPushMirror(cfg.Gitea.Username, repoName, gitea.PushMirrorRequest{
-				RemoteAddress:  fmt.Sprintf("%s/%s/%s.git", gitlabURL, cfg.GitLab.Username, repoName),
-				RemotePassword: cfg.GitLab.Token,
-				RemoteUsername: cfg.GitLab.Username,
-				SyncOnCommit:   true,
-				Interval:       "8h",
-			})
-			if err != nil {
-				return fmt.Errorf("failed to set up mirror: %w", err)
-			}
-			fmt.Println("  ✓ Mirror configured")
+		// 3. Set up push mirrors
+		fmt.Fprintln(out, "\n3. Setting up push mirrors...")
+		opts := defaultMirrorOptions
+		opts.KeepExisting = true
+		addPushMirrors(cmd.Context(), out, giteaClient, cfg.Gitea.RepoOwner(), repoName, opts, results)
+		if exists {
+			undo.recordPushMirrors(giteaClient, cfg.Gitea.RepoOwner(), repoName, opts, results)
 		}
 
 		// 4. Set up git remote and push
-		fmt.Println("\n4. Configuring git remote...")
-		if err := setupGitRemote(absPath, repoName, cfg); err != nil {
+		fmt.Fprintln(out, "\n4. Configuring git remote...")
+		gitState, err := saveGitState(cmd.Context(), absPath, cfg)
+		if err != nil {
+			return err
+		}
+		undo.record(fmt.Sprintf("git remotes and Gitea git config of %s", absPath), gitState.restore)
+		if err := setupGitRemote(cmd.Context(), absPath, repoName, cfg, succeededTargets(results)); err != nil {
 			return err
 		}
 
 		// 5. Done!
-		fmt.Println("\n================================================")
-		fmt.Println("✓ Repository successfully added!")
-		fmt.Println("================================================")
-		fmt.Printf("\nRepository URLs:\n")
-		fmt.Printf("  Gitea:  %s/%s/%s\n", cfg.Gitea.URL, cfg.Gitea.Username, repoName)
-		if addUseGitHub {
-			fmt.Printf("  GitHub: https://github.com/%s/%s\n", cfg.GitHub.Username, repoName)
-		} else {
-			gitlabURL := cfg.GitLab.URL
-			if gitlabURL == "" {
-				gitlabURL = "https://gitlab.com"
-			}
-			fmt.Printf("  GitLab: %s/%s/%s\n", gitlabURL, cfg.GitLab.Username, repoName)
-		}
-		fmt.Println("\nYour local repository is now:")
-		fmt.Println("  • Connected to Gitea as 'origin'")
-		if addUseGitHub {
-			fmt.Println("  • Mirroring to GitHub automatically")
-		} else {
-			fmt.Println("  • Mirroring to GitLab automatically")
+		fmt.Fprintln(out, "\n================================================")
+		fmt.Fprintln(out, "✓ Repository successfully added!")
+		fmt.Fprintln(out, "================================================")
+		fmt.Fprintf(out, "\nRepository URLs:\n")
+		fmt.Fprintf(out, "  Gitea:  %s\n", giteaWebURL(cfg, repoName))
+		printTargetURLs(results, repoName)
+		fmt.Fprintln(out, "\nYour local repository is now:")
+		fmt.Fprintln(out, "  • Connected to Gitea as 'origin'")
+		fmt.Fprintf(out, "  • Mirroring to %s automatically\n", targetNames(succeededTargets(results)))
+		fmt.Fprintln(out, "  • Ready for commits")
+		fmt.Fprintln(out, "================================================")
+
+		// The Gitea repository serves the targets that worked, so only the
+		// resources of the failed targets are offered for deletion
+		err = targetsError(results)
+		if err != nil {
+			undo.retainFailed(results)
 		}
-		fmt.Println("  • Ready for commits")
-		fmt.Println("================================================")
-
-		return nil
+		return err
 	},
 }
 
@@ -252,73 +234,75 @@ func isGitRepo(path string) bool {
 	return info.IsDir()
 }
 
-func setupGitRemote(repoPath, repoName string, cfg *config.Config) error {
+func setupGitRemote(ctx context.Context, repoPath, repoName string, cfg *config.Config, targets []forge.Provider) error {
 	// Check if 'origin' remote exists
-	cmd := exec.Command("git", "remote", "get-url", "origin")
+	cmd := exec.CommandContext(ctx, "git", "remote", "get-url", "origin")
 	cmd.Dir = repoPath
 	output, err := cmd.Output()
 
-	giteaRemoteURL := fmt.Sprintf("http://%s:%s@%s/%s/%s.git",
-		cfg.Gitea.Username,
-		cfg.Gitea.Token,
-		strings.TrimPrefix(cfg.Gitea.URL, "http://"),
-		cfg.Gitea.Username,
-		repoName)
+	remoteURL := giteaRemoteURL(cfg, repoName)
+
+	// Let git fetch the token from gitea-sync instead of the remote URL
+	if err := configureGiteaGit(ctx, repoPath, cfg); err != nil {
+		return err
+	}
 
 	if err != nil {
 		// No origin remote exists, add it
-		fmt.Println("  → Adding Gitea as origin remote...")
-		cmd = exec.Command("git", "remote", "add", "origin", giteaRemoteURL)
+		fmt.Fprintln(out, "  → Adding Gitea as origin remote...")
+		cmd = exec.CommandContext(ctx, "git", "remote", "add", "origin", remoteURL)
 		cmd.Dir = repoPath
-		if err := cmd.Run(); err != nil {
+		if err := runGit(cmd); err != nil {
 			return fmt.Errorf("failed to add remote: %w", err)
 		}
-		fmt.Println("  ✓ Remote added")
+		fmt.Fprintln(out, "  ✓ Remote added")
 	} else {
 		// Origin exists, check if it's Gitea
 		existingRemote := strings.TrimSpace(string(output))
-		if !strings.Contains(existingRemote, cfg.Gitea.URL) {
+		if !isGiteaRemote(existingRemote, cfg) {
 			// Origin points elsewhere, add Gitea as 'gitea' remote
-			fmt.Printf("  ℹ Origin exists (%s)\n", existingRemote)
-			fmt.Println("  → Adding Gitea as 'gitea' remote...")
+			fmt.Fprintf(out, "  ℹ Origin exists (%s)\n", existingRemote)
+			fmt.Fprintln(out, "  → Adding Gitea as 'gitea' remote...")
 
 			// Remove gitea remote if it exists
-			exec.Command("git", "remote", "remove", "gitea").Run()
+			cmd = exec.CommandContext(ctx, "git", "remote", "remove", "gitea")
+			cmd.Dir = repoPath
+			runGit(cmd)
 
-			cmd = exec.Command("git", "remote", "add", "gitea", giteaRemoteURL)
+			cmd = exec.CommandContext(ctx, "git", "remote", "add", "gitea", remoteURL)
 			cmd.Dir = repoPath
-			if err := cmd.Run(); err != nil {
+			if err := runGit(cmd); err != nil {
 				return fmt.Errorf("failed to add gitea remote: %w", err)
 			}
-			fmt.Println("  ✓ Remote 'gitea' added")
+			fmt.Fprintln(out, "  ✓ Remote 'gitea' added")
 
-			fmt.Println("\n  → Pushing to Gitea...")
-			cmd = exec.Command("git", "push", "-u", "gitea", "main")
+			fmt.Fprintln(out, "\n  → Pushing to Gitea...")
+			cmd = exec.CommandContext(ctx, "git", "push", "-u", "gitea", "main")
 			cmd.Dir = repoPath
-			if err := cmd.Run(); err != nil {
+			if err := runGit(cmd); err != nil {
 				// Try 'master' if 'main' fails
-				cmd = exec.Command("git", "push", "-u", "gitea", "master")
+				cmd = exec.CommandContext(ctx, "git", "push", "-u", "gitea", "master")
 				cmd.Dir = repoPath
-				if err := cmd.Run(); err != nil {
+				if err := runGit(cmd); err != nil {
 					return fmt.Errorf("failed to push (tried both 'main' and 'master'): %w", err)
 				}
 			}
-			fmt.Println("  ✓ Pushed to Gitea (use 'git push gitea' in the future)")
+			fmt.Fprintln(out, "  ✓ Pushed to Gitea (use 'git push gitea' in the future)")
 			return nil
 		}
 
 		// Origin is already Gitea, update it
-		fmt.Println("  → Updating origin URL...")
-		cmd = exec.Command("git", "remote", "set-url", "origin", giteaRemoteURL)
+		fmt.Fprintln(out, "  → Updating origin URL...")
+		cmd = exec.CommandContext(ctx, "git", "remote", "set-url", "origin", remoteURL)
 		cmd.Dir = repoPath
-		if err := cmd.Run(); err != nil {
+		if err := runGit(cmd); err != nil {
 			return fmt.Errorf("failed to update remote: %w", err)
 		}
-		fmt.Println("  ✓ Remote updated")
+		fmt.Fprintln(out, "  ✓ Remote updated")
 	}
 
 	// Get current branch
-	cmd = exec.Command("git", "branch", "--show-current")
+	cmd = exec.CommandContext(ctx, "git", "branch", "--show-current")
 	cmd.Dir = repoPath
 	branchOutput, err := cmd.Output()
 	if err != nil {
@@ -330,16 +314,16 @@ func setupGitRemote(repoPath, repoName string, cfg *config.Config) error {
 	}
 
 	// Push to origin
-	fmt.Printf("  → Pushing to Gitea (branch: %s)...\n", branch)
-	cmd = exec.Command("git", "push", "-u", "origin", branch)
+	fmt.Fprintf(out, "  → Pushing to Gitea (branch: %s)...\n", branch)
+	cmd = exec.CommandContext(ctx, "git", "push", "-u", "origin", branch)
 	cmd.Dir = repoPath
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = out
 	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
+	if err := runGit(cmd); err != nil {
 		return fmt.Errorf("failed to push: %w", err)
 	}
-	fmt.Println("  ✓ Pushed to Gitea")
-	fmt.Println("  ✓ Mirroring to GitHub...")
+	fmt.Fprintln(out, "  ✓ Pushed to Gitea")
+	fmt.Fprintf(out, "  ✓ Mirroring to %s...\n", targetNames(targets))
 
 	return nil
 }
@@ -347,7 +331,10 @@ func setupGitRemote(repoPath, repoName string, cfg *config.Config) error {
 func init() {
 	addCmd.Flags().BoolVarP(&addPrivateFlag, "private", "p", false, "Make the repository private")
 	addCmd.Flags().StringVarP(&addRepoName, "name", "n", "", "Custom repository name (defaults to directory name)")
-	addCmd.Flags().BoolVar(&addUseGitLab, "gitlab", false, "Mirror to GitLab instead of GitHub")
-	addCmd.Flags().BoolVar(&addUseGitHub, "github", false, "Mirror to GitHub (default)")
+	addCmd.Flags().BoolVar(&addUseGitLab, "gitlab", false, "Mirror to GitLab (same as --target gitlab)")
+	addCmd.Flags().BoolVar(&addUseGitHub, "github", false, "Mirror to GitHub (same as --target github)")
+	addTargetFlag(addCmd, &addTargets)
+	addOwnerFlag(addCmd, &addOwner)
+	addCmd.Flags().BoolVar(&addRollback, "rollback", false, "On failure, delete the repositories and mirrors this run created without asking")
 	rootCmd.AddCommand(addCmd)
 }
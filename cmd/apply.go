@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/Papiermond/gitea-sync/internal/manifest"
+	"github.com/spf13/cobra"
+)
+
+var applyFile string
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Make Gitea and the mirror targets match a repository manifest",
+	Long: `Make Gitea and the mirror targets match a repository manifest.
+
+The changes shown by 'gitea-sync plan' are made in order. When a change
+fails, the remaining changes of that repository are skipped and the other
+repositories are still processed. Nothing is ever deleted except a push
+mirror that is replaced because its settings differ from the manifest,
+and only after its replacement was added.
+
+Examples:
+  gitea-sync apply -f repos.yaml`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := manifest.Load(applyFile)
+		if err != nil {
+			return err
+		}
+
+		// Load config
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		// Initialize client
+		giteaClient, err := newGiteaClient(cfg)
+		if err != nil {
+			return err
+		}
+
+		changes, err := planManifest(cmd.Context(), cfg, giteaClient, m)
+		if err != nil {
+			return err
+		}
+
+		printPlan(applyFile, changes)
+		result := planResult{File: applyFile, Changes: make([]changeResult, 0, len(changes))}
+		if len(changes) == 0 {
+			if jsonOutput() {
+				return printJSON(result)
+			}
+			return nil
+		}
+
+		fmt.Fprintln(out, "\nApplying changes...")
+		applied := 0
+		failedRepos := make(map[string]bool)
+		var failed []string
+		for _, c := range changes {
+			changeResult := c.result()
+			if failedRepos[c.repo] {
+				fmt.Fprintf(out, "  - skipped %s %s\n", c.action, c.summary)
+				changeResult.Status = "skipped"
+			} else if err := c.apply(cmd.Context()); err != nil {
+				fmt.Fprintf(out, "  ✗ %s %s: %v\n", c.action, c.summary, err)
+				changeResult.Status = "failed"
+				changeResult.Error = newErrorResult(err)
+				failedRepos[c.repo] = true
+				failed = append(failed, c.repo)
+			} else {
+				fmt.Fprintf(out, "  ✓ %s %s\n", c.action, c.summary)
+				changeResult.Status = "applied"
+				applied++
+			}
+			result.Changes = append(result.Changes, changeResult)
+		}
+
+		fmt.Fprintln(out, "\n================================================")
+		fmt.Fprintf(out, "✓ Applied %d/%d changes\n", applied, len(changes))
+		fmt.Fprintln(out, "================================================")
+
+		if jsonOutput() {
+			if err := printJSON(result); err != nil {
+				return err
+			}
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("apply failed for %d repositories: %v", len(failed), failed)
+		}
+		return nil
+	},
+}
+
+func init() {
+	applyCmd.Flags().StringVarP(&applyFile, "file", "f", "repos.yaml", "Path to the repository manifest")
+	rootCmd.AddCommand(applyCmd)
+}
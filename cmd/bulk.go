@@ -2,105 +2,400 @@ package cmd
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"sync"
 
+	"github.com/Papiermond/gitea-sync/internal/apierror"
+	"github.com/Papiermond/gitea-sync/internal/bulkfile"
 	"github.com/Papiermond/gitea-sync/internal/config"
+	"github.com/Papiermond/gitea-sync/internal/forge"
 	"github.com/Papiermond/gitea-sync/internal/gitea"
+	"github.com/Papiermond/gitea-sync/internal/journal"
 	"github.com/spf13/cobra"
 )
 
+var (
+	bulkTargets     []string
+	bulkConcurrency int
+	bulkFile        string
+	bulkResume      string
+	bulkRetryFailed bool
+	bulkOwner       string
+)
+
+// bulkResult is the outcome of one repository of a bulk run. The output of
+// the repository is buffered so that concurrent runs print in input order.
+type bulkResult struct {
+	entry   bulkfile.Entry
+	record  *journal.Entry
+	targets []forge.Provider
+	repo    repoResult
+	output  bytes.Buffer
+	err     error
+	done    chan struct{}
+}
+
 var bulkCmd = &cobra.Command{
 	Use:   "bulk",
 	Short: "Bulk setup mirrors for multiple repositories",
 	Long: `Bulk setup mirrors for multiple repositories.
 You will be prompted to enter repository names, one per line.
-Press Ctrl+D (EOF) when done.`,
+Press Ctrl+D (EOF) when done.
+
+With --file, repositories and their options are read from a CSV or YAML
+file instead. Every row can set the visibility, the mirror targets, the
+mirror interval, sync on commit, the description and a different
+repository name on the targets. All rows are validated before any API
+call is made.
+
+CSV (the header row names the columns, only "name" is required):
+
+  name,target_name,visibility,targets,interval,sync_on_commit,description
+  tool,,private,github;gitlab,1h,true,Internal tool
+  website,my-website,public,github,8h,false,
+
+YAML:
+
+  repos:
+    - name: tool
+      visibility: private
+      targets: [github, gitlab]
+      interval: 1h
+      description: Internal tool
+    - name: website
+      target_name: my-website
+      sync_on_commit: false
+
+Use --concurrency to process several repositories at once. Output is
+still printed per repository in input order. A dry run always processes
+one repository at a time.
+
+Every run records the state of each repository (Gitea repository created,
+mirrors added, error) in a journal under $XDG_STATE_HOME/gitea-sync/journal
+(default ~/.local/state/gitea-sync/journal). Use
+--resume <journal> to process only the repositories of that run that are
+failed or were not reached, or --retry-failed to do the same for the most
+recent run.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if bulkConcurrency < 1 {
+			return fmt.Errorf("--concurrency must be at least 1")
+		}
+
 		// Load config
-		cfg, err := config.Load()
+		cfg, err := loadConfig()
 		if err != nil {
 			return err
 		}
+		applyOwnerFlag(cmd, cfg, bulkOwner)
 
-		// Get repository list
-		fmt.Println("Enter repository names (one per line, Ctrl+D when done):")
-		var repos []string
-		scanner := bufio.NewScanner(os.Stdin)
-		for scanner.Scan() {
-			line := strings.TrimSpace(scanner.Text())
-			if line != "" {
-				repos = append(repos, line)
+		// Get repository list, from the journal of an earlier run when
+		// resuming it
+		var j *journal.Journal
+		var records []*journal.Entry
+		if bulkResume != "" || bulkRetryFailed {
+			j, err = loadBulkJournal()
+			if err != nil {
+				return err
+			}
+			// Keep the repositories of the run with their owner
+			if j.Owner != "" {
+				cfg.Gitea.Owner = j.Owner
+			}
+			records = j.Incomplete()
+			if len(records) == 0 {
+				fmt.Fprintf(out, "✓ All repositories of %s are complete, nothing to retry\n", j.Path())
+				return nil
+			}
+		} else {
+			entries, err := readBulkEntries()
+			if err != nil {
+				return err
 			}
+			if len(entries) == 0 {
+				return fmt.Errorf("no repositories provided")
+			}
+			j = journal.New(entries, bulkTargets)
+			j.Owner = cfg.Gitea.RepoOwner()
+			records = j.Entries
 		}
 
-		if len(repos) == 0 {
-			return fmt.Errorf("no repositories provided")
+		// Resolve the mirror targets of every entry before any API call
+		results := make([]*bulkResult, len(records))
+		var problems []error
+		for i, record := range records {
+			entry := record.Repo
+			names := entry.Targets
+			if len(names) == 0 {
+				names = j.Targets
+			}
+			targets, err := resolveTargets(cfg, names, false, false)
+			if err != nil {
+				problems = append(problems, fmt.Errorf("line %d: %w", entry.Line, err))
+			}
+			results[i] = &bulkResult{entry: entry, record: record, targets: targets, done: make(chan struct{})}
+		}
+		if len(problems) > 0 {
+			return errors.Join(problems...)
 		}
 
 		// Initialize client
-		giteaClient := gitea.NewClient(cfg.Gitea.URL, cfg.Gitea.Token)
+		giteaClient, err := newGiteaClient(cfg)
+		if err != nil {
+			return err
+		}
+		if err := checkGiteaOwner(cmd.Context(), giteaClient, cfg); err != nil {
+			return err
+		}
 
-		fmt.Println("\n================================================")
-		fmt.Printf("Processing %d repositories\n", len(repos))
-		fmt.Println("================================================")
+		// A dry run changes nothing, so it leaves no journal either
+		if dryRun {
+			j.Detach()
+		} else if j.Path() == "" {
+			if err := j.Create(); err != nil {
+				return fmt.Errorf("failed to write journal: %w", err)
+			}
+		}
+
+		fmt.Fprintln(out, "\n================================================")
+		fmt.Fprintf(out, "Processing %d repositories", len(results))
+		if bulkConcurrency > 1 && !dryRun {
+			fmt.Fprintf(out, " (%d at a time)", bulkConcurrency)
+		}
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "================================================")
 
 		successCount := 0
-		for _, repoName := range repos {
-			fmt.Printf("\n================================================\n")
-			fmt.Printf("Processing: %s\n", repoName)
+		printResult := func(result *bulkResult) {
+			result.repo.emit(result.err)
+			if result.err != nil {
+				fmt.Fprintf(out, "  ✗ %v\n", result.err)
+				return
+			}
+			fmt.Fprintf(out, "  ✓ %s complete!\n", result.entry.Name)
+			successCount++
+		}
 
-			// Check if repo exists in Gitea
-			exists, err := giteaClient.RepoExists(cfg.Gitea.Username, repoName)
-			if err != nil {
-				fmt.Printf("  ✗ Error checking repo: %v\n", err)
-				continue
-			}
-
-			if !exists {
-				// Create repo
-				fmt.Println("  → Creating Gitea repo...")
-				err = giteaClient.CreateRepo(gitea.CreateRepoRequest{
-					Name:     repoName,
-					Private:  false,
-					AutoInit: false,
-				})
-				if err != nil {
-					fmt.Printf("  ✗ Failed to create repo: %v\n", err)
-					continue
+		// Dry-run writes are printed as they are made, so process one
+		// repository at a time and print its output directly
+		if dryRun {
+			for i, result := range results {
+				printBulkHeader(i, len(results), result.entry.Name)
+				result.err = processBulkRepo(cmd.Context(), out, giteaClient, cfg, j, result)
+				printResult(result)
+			}
+		} else {
+			// Bounded worker pool
+			jobs := make(chan *bulkResult)
+			var wg sync.WaitGroup
+			for range min(bulkConcurrency, len(results)) {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for result := range jobs {
+						result.err = processBulkRepo(cmd.Context(), &result.output, giteaClient, cfg, j, result)
+						close(result.done)
+					}
+				}()
+			}
+			go func() {
+				for _, result := range results {
+					jobs <- result
 				}
-				fmt.Println("  ✓ Gitea repo created")
+				close(jobs)
+			}()
+
+			// Print each repository as soon as it and all before it are done
+			for i, result := range results {
+				<-result.done
+				printBulkHeader(i, len(results), result.entry.Name)
+				out.Write(result.output.Bytes())
+				printResult(result)
+			}
+			wg.Wait()
+		}
+
+		fmt.Fprintln(out, "\n================================================")
+		fmt.Fprintln(out, "Summary:")
+		for _, result := range results {
+			if result.err != nil {
+				fmt.Fprintf(out, "  ✗ %s: %v\n", result.entry.Name, result.err)
 			} else {
-				fmt.Println("  ✓ Gitea repo already exists")
-			}
-
-			// Add push mirror
-			fmt.Println("  → Setting up GitHub mirror...")
-			err = giteaClient.AddPushMirror(cfg.Gitea.Username, repoName, gitea.PushMirrorRequest{
-				RemoteAddress:  fmt.Sprintf("https://github.com/%s/%s.git", cfg.GitHub.Username, repoName),
-				RemotePassword: cfg.GitHub.Token,
-				RemoteUsername: cfg.GitHub.Username,
-				SyncOnCommit:   true,
-				Interval:       "8h",
-			})
-			if err != nil {
-				fmt.Printf("  ✗ Mirror setup failed: %v\n", err)
-				continue
+				fmt.Fprintf(out, "  ✓ %s\n", result.entry.Name)
+			}
+		}
+		fmt.Fprintf(out, "\n✓ Completed %d/%d repositories\n", successCount, len(results))
+		if j.Path() != "" {
+			fmt.Fprintf(out, "Journal: %s\n", j.Path())
+			if successCount < len(results) {
+				fmt.Fprintln(out, "Retry the failed repositories with: gitea-sync bulk --retry-failed")
 			}
-			fmt.Println("  ✓ Mirror configured")
-			fmt.Printf("  ✓ %s complete!\n", repoName)
-			successCount++
 		}
+		fmt.Fprintln(out, "================================================")
 
-		fmt.Println("\n================================================")
-		fmt.Printf("✓ Completed %d/%d repositories\n", successCount, len(repos))
-		fmt.Println("================================================")
+		if err := j.Err(); err != nil {
+			return fmt.Errorf("failed to write journal: %w", err)
+		}
+		if err := cmd.Context().Err(); err != nil {
+			return fmt.Errorf("interrupted: %w", err)
+		}
 
 		return nil
 	},
 }
 
+func printBulkHeader(i, n int, repoName string) {
+	fmt.Fprintf(out, "\n================================================\n")
+	fmt.Fprintf(out, "[%d/%d] Processing: %s\n", i+1, n, repoName)
+}
+
+// readBulkEntries reads the entries from --file, or repository names from
+// stdin with the default options.
+func readBulkEntries() ([]bulkfile.Entry, error) {
+	if bulkFile != "" {
+		return bulkfile.Load(bulkFile)
+	}
+
+	fmt.Fprintln(out, "Enter repository names (one per line, Ctrl+D when done):")
+	var entries []bulkfile.Entry
+	scanner := bufio.NewScanner(os.Stdin)
+	for line := 1; scanner.Scan(); line++ {
+		name := strings.TrimSpace(scanner.Text())
+		if name != "" {
+			entry := bulkfile.NewEntry(name)
+			entry.Line = line
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// processBulkRepo sets up the repository of result and records the outcome
+// in the journal. Once ctx is cancelled, repositories are skipped and stay
+// pending in the journal.
+func processBulkRepo(ctx context.Context, w io.Writer, giteaClient *gitea.Client, cfg *config.Config, j *journal.Journal, result *bulkResult) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	err := setupBulkRepo(ctx, w, giteaClient, cfg, j, result)
+	j.Update(result.record, func(e *journal.Entry) {
+		if err != nil {
+			e.Status = journal.Failed
+			e.Error = err.Error()
+			return
+		}
+		e.Status = journal.Done
+		e.Error = ""
+	})
+	return err
+}
+
+// setupBulkRepo creates the repository of result on Gitea if needed and
+// adds its push mirrors, writing progress to w and each step to the journal
+// and the result.
+func setupBulkRepo(ctx context.Context, w io.Writer, giteaClient *gitea.Client, cfg *config.Config, j *journal.Journal, result *bulkResult) error {
+	record, targets := result.record, result.targets
+	entry := record.Repo
+	repoName := entry.Name
+	result.repo = repoResult{Repo: repoName}
+
+	// Check if repo exists in Gitea
+	exists, err := giteaClient.RepoExists(ctx, cfg.Gitea.RepoOwner(), repoName)
+	if err != nil {
+		return fmt.Errorf("error checking repo: %w", withHint(err))
+	}
+	result.repo.URL = giteaWebURL(cfg, repoName)
+
+	if !exists {
+		// Create repo
+		fmt.Fprintln(w, "  → Creating Gitea repo...")
+		err = createGiteaRepo(ctx, giteaClient, cfg, gitea.CreateRepoRequest{
+			Name:        repoName,
+			Description: entry.Description,
+			Private:     entry.Private,
+			AutoInit:    false,
+		})
+		switch {
+		case apierror.IsConflict(err):
+			// Created since the check, e.g. by a concurrent run
+			exists = true
+		case err != nil:
+			return fmt.Errorf("failed to create repo: %w", withHint(err))
+		default:
+			fmt.Fprintln(w, "  ✓ Gitea repo created")
+			j.Update(record, func(e *journal.Entry) { e.GiteaRepo = journal.RepoCreated })
+			result.repo.Gitea = stateCreated
+		}
+	}
+	if exists {
+		fmt.Fprintln(w, "  ✓ Gitea repo already exists")
+		result.repo.Gitea = stateExisted
+		// Keep "created" from the earlier attempt of a resumed run
+		j.Update(record, func(e *journal.Entry) {
+			if e.GiteaRepo == "" {
+				e.GiteaRepo = journal.RepoExisted
+			}
+		})
+	}
+
+	// Add push mirrors
+	fmt.Fprintf(w, "  → Setting up push mirrors (%s)...\n", targetNames(targets))
+	targetResults := newTargetResults(targets)
+	opts := mirrorOptions{
+		Interval:     entry.Interval,
+		SyncOnCommit: entry.SyncOnCommit,
+		TargetRepo:   entry.TargetName,
+	}
+	addPushMirrors(ctx, w, giteaClient, cfg.Gitea.RepoOwner(), repoName, opts, targetResults)
+	result.repo.setTargets(targetResults, repoName, opts)
+	j.Update(record, func(e *journal.Entry) {
+		e.Mirrors = make(map[string]string, len(targetResults))
+		for _, result := range targetResults {
+			e.Mirrors[result.target.Name()] = journal.MirrorConfigured
+			if result.err != nil {
+				e.Mirrors[result.target.Name()] = result.err.Error()
+			}
+		}
+	})
+	if err := targetsError(targetResults); err != nil {
+		return fmt.Errorf("mirror setup failed: %w", err)
+	}
+	return nil
+}
+
 func init() {
+	addTargetFlag(bulkCmd, &bulkTargets)
+	addOwnerFlag(bulkCmd, &bulkOwner)
+	bulkCmd.Flags().StringVarP(&bulkFile, "file", "f", "", "Read repositories and their options from a CSV or YAML file")
+	bulkCmd.Flags().IntVarP(&bulkConcurrency, "concurrency", "c", 1, "Number of repositories to process at once")
+	bulkCmd.Flags().StringVar(&bulkResume, "resume", "", "Retry the failed and unprocessed repositories recorded in a journal")
+	bulkCmd.Flags().BoolVar(&bulkRetryFailed, "retry-failed", false, "Retry the failed and unprocessed repositories of the most recent run")
+	bulkCmd.MarkFlagsMutuallyExclusive("resume", "retry-failed", "file")
+	bulkCmd.MarkFlagsMutuallyExclusive("resume", "retry-failed", "target")
+	bulkCmd.MarkFlagsMutuallyExclusive("resume", "retry-failed", "owner", "org")
 	rootCmd.AddCommand(bulkCmd)
 }
+
+// loadBulkJournal loads the journal named by --resume, or the most recent
+// one for --retry-failed.
+func loadBulkJournal() (*journal.Journal, error) {
+	path := bulkResume
+	if bulkRetryFailed {
+		var err error
+		path, err = journal.Latest()
+		if err != nil {
+			return nil, err
+		}
+	}
+	j, err := journal.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(out, "Resuming %s (started %s)\n", path, j.Started.Format("2006-01-02 15:04"))
+	return j, nil
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Papiermond/gitea-sync/internal/config"
+	"github.com/Papiermond/gitea-sync/internal/dryrun"
+	"github.com/Papiermond/gitea-sync/internal/gitea"
+	"github.com/Papiermond/gitea-sync/internal/ratelimit"
+	"github.com/Papiermond/gitea-sync/internal/retry"
+)
+
+// newHTTPClient returns the HTTP client shared by the API clients. It waits
+// out rate limits instead of failing, limits each request to the configured
+// timeout, retries failed reads and uses tlsConfig if it is not nil. In a
+// dry run, writes are printed instead of sent. Retries and waits are
+// reported in the progress output, so --quiet silences them.
+func newHTTPClient(cfg *config.Config, tlsConfig *tls.Config) (*http.Client, error) {
+	timeout, err := cfg.HTTP.TimeoutDuration()
+	if err != nil {
+		return nil, err
+	}
+	retries, err := cfg.HTTP.RetryCount()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	var base http.RoundTripper = transport
+	if dryRun {
+		base = &dryrun.Transport{
+			Base: transport,
+			OnWrite: func(req *http.Request, payload string) {
+				fmt.Fprintln(out, strings.TrimRight(fmt.Sprintf("  [dry-run] %s %s %s", req.Method, req.URL.Redacted(), payload), " "))
+			},
+		}
+	}
+
+	return &http.Client{
+		Transport: &ratelimit.Transport{
+			Base: &retry.Transport{
+				Base:    base,
+				Retries: retries,
+				Timeout: timeout,
+				OnRetry: func(req *http.Request, wait time.Duration, resp *http.Response, err error) {
+					reason := "failed"
+					if err == nil {
+						reason = resp.Status
+					}
+					fmt.Fprintf(out, "  ⏳ %s %s %s, retrying in %s\n", req.Method, req.URL.Redacted(), reason, wait.Round(time.Second))
+				},
+			},
+			OnWait: func(req *http.Request, wait time.Duration) {
+				fmt.Fprintf(out, "  ⏳ Rate limited by %s, retrying in %s\n", req.URL.Host, wait.Round(time.Second))
+			},
+		},
+	}, nil
+}
+
+// newGiteaClient returns an API client for the configured Gitea instance,
+// trusting the configured CA bundle and presenting the client certificate.
+// It reads the Gitea token from its configured source.
+func newGiteaClient(cfg *config.Config) (*gitea.Client, error) {
+	endpoint, err := cfg.Gitea.Endpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := cfg.Gitea.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := cfg.Gitea.Resolve("gitea")
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient, err := newHTTPClient(cfg, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	return gitea.NewClient(endpoint.BaseURL(), token, httpClient), nil
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Papiermond/gitea-sync/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// redacted replaces secrets in the output of config show.
+const redacted = "REDACTED"
+
+// settingResult is one effective setting shown by config show.
+type settingResult struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	// Source is where the value comes from: "file", "project PATH",
+	// "env VAR", "flag --x", "default" or "unset".
+	Source string `json:"source"`
+	// Env is the environment variable overriding the setting.
+	Env string `json:"env"`
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the effective configuration",
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the effective settings and where each one comes from",
+	Long: `Print the effective settings of the selected profile and where each one
+comes from. Tokens are redacted.
+
+Each setting is taken from the first of:
+  1. its global flag, e.g. --gitea-url. Tokens have no flag; use their
+     environment variable, or --gitea-token-cmd or --gitea-token-file
+  2. its environment variable, e.g. GITEA_SYNC_GITEA_URL
+  3. the project file .gitea-sync.yaml in the current directory or one
+     of its parents (targets and gitea.owner)
+  4. the selected profile of the config file
+  5. the built-in default
+
+The config file is $XDG_CONFIG_HOME/gitea-sync/config.yaml, or
+~/.gitea-sync.yaml if it exists and the former does not. --config selects
+another file.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		path, err := config.ConfigPath()
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(path); err != nil {
+			path = ""
+		}
+		project, err := findProject(".")
+		if err != nil {
+			return err
+		}
+		project.Apply(cfg)
+
+		settings := make([]settingResult, 0, len(config.Keys()))
+		for _, key := range config.Keys() {
+			setting := settingResult{
+				Key:    key,
+				Value:  cfg.Get(key),
+				Source: cfg.Sources[key],
+				Env:    config.EnvName(key),
+			}
+			switch {
+			case setting.Source != "" && config.IsSecret(key):
+				setting.Value = redacted
+			case setting.Source == "" && config.DefaultValue(key) != "":
+				setting.Value = config.DefaultValue(key)
+				setting.Source = config.SourceDefault
+			case setting.Source == "":
+				setting.Source = "unset"
+			}
+			settings = append(settings, setting)
+		}
+
+		if jsonOutput() {
+			return printJSON(struct {
+				Profile  string          `json:"profile"`
+				Config   string          `json:"config"`
+				Project  string          `json:"project"`
+				Settings []settingResult `json:"settings"`
+			}{cfg.Profile, path, project.Path, settings})
+		}
+
+		if path == "" {
+			path = "(none)"
+		}
+		fmt.Fprintf(out, "Profile: %s\n", cfg.Profile)
+		fmt.Fprintf(out, "Config file: %s\n", path)
+		if project.Path != "" {
+			fmt.Fprintf(out, "Project file: %s\n", project.Path)
+		}
+		fmt.Fprintln(out)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tVALUE\tSOURCE")
+		for _, setting := range settings {
+			value := setting.Value
+			if value == "" {
+				value = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", setting.Key, value, setting.Source)
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configShowCmd)
+	rootCmd.AddCommand(configCmd)
+}
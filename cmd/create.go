@@ -1,239 +1,197 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"time"
 
+	"github.com/Papiermond/gitea-sync/internal/apierror"
 	"github.com/Papiermond/gitea-sync/internal/config"
+	"github.com/Papiermond/gitea-sync/internal/forge"
 	"github.com/Papiermond/gitea-sync/internal/gitea"
-	"github.com/Papiermond/gitea-sync/internal/github"
-	"github.com/Papiermond/gitea-sync/internal/gitlab"
 	"github.com/spf13/cobra"
 )
 
 var (
-	privateFlag bool
-	useGitLab   bool
-	useGitHub   bool
+	privateFlag    bool
+	useGitLab      bool
+	useGitHub      bool
+	createTargets  []string
+	createRollback bool
+	createOwner    string
 )
 
 var createCmd = &cobra.Command{
 	Use:   "create <repo-name>",
-	Short: "Create a new repository on Gitea with mirroring to GitHub or GitLab",
+	Short: "Create a new repository on Gitea with mirroring to GitHub, GitLab or another target",
 	Args:  cobra.ExactArgs(1),
-	RunE: func(cmd *cobra.Command, args []string) error {
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
 		repoName := args[0]
 
-		// Validate flags
-		if useGitLab && useGitHub {
-			return fmt.Errorf("cannot use both -gitlab and -github flags")
-		}
-
-		// Default to GitHub if neither flag is set
-		if !useGitLab && !useGitHub {
-			useGitHub = true
-		}
+		// Print the JSON result once the command returns
+		result := &repoResult{Repo: repoName}
+		var results []*targetResult
+		defer func() {
+			result.setTargets(results, repoName, defaultMirrorOptions)
+			result.emit(err)
+		}()
 
 		// Load config
-		cfg, err := config.Load()
+		cfg, err := loadConfig()
 		if err != nil {
 			return err
 		}
 
-		// Validate configuration based on selected platform
-		if useGitLab {
-			if cfg.GitLab.Token == "" || cfg.GitLab.Username == "" {
-				return fmt.Errorf("GitLab credentials not configured. Run 'gitea-sync init' to configure")
-			}
+		// Read the defaults of the project in the current directory
+		project, err := findProject(".")
+		if err != nil {
+			return err
 		}
+		project.Apply(cfg)
+		applyOwnerFlag(cmd, cfg, createOwner)
+		private := project.Private(privateFlag, cmd.Flags().Changed("private"))
 
-		// Initialize clients
-		giteaClient := gitea.NewClient(cfg.Gitea.URL, cfg.Gitea.Token)
-		var githubClient *github.Client
-		var gitlabClient *gitlab.Client
-
-		if useGitHub {
-			githubClient = github.NewClient(cfg.GitHub.Token)
-		} else {
-			gitlabClient = gitlab.NewClient(cfg.GitLab.URL, cfg.GitLab.Token)
+		// Resolve the mirror targets
+		targets, err := resolveTargets(cfg, createTargets, useGitHub, useGitLab)
+		if err != nil {
+			return err
 		}
 
-		fmt.Println("================================================")
-		fmt.Printf("Creating repository: %s\n", repoName)
-		fmt.Printf("Privacy setting: %t\n", privateFlag)
-		if useGitHub {
-			fmt.Println("Mirror target: GitHub")
-		} else {
-			fmt.Println("Mirror target: GitLab")
+		// Initialize client
+		giteaClient, err := newGiteaClient(cfg)
+		if err != nil {
+			return err
+		}
+		if err := checkGiteaOwner(cmd.Context(), giteaClient, cfg); err != nil {
+			return err
 		}
-		fmt.Println("================================================")
 
-		// 1. Create on GitHub or GitLab
-		var exists bool
-		if useGitHub {
-			fmt.Println("\n1. Checking GitHub...")
-			exists, err = githubClient.RepoExists(cfg.GitHub.Username, repoName)
-			if err != nil {
-				return fmt.Errorf("failed to check GitHub: %w", err)
-			}
+		fmt.Fprintln(out, "================================================")
+		fmt.Fprintf(out, "Creating repository: %s/%s\n", cfg.Gitea.RepoOwner(), repoName)
+		fmt.Fprintf(out, "Privacy setting: %t\n", private)
+		fmt.Fprintf(out, "Mirror targets: %s\n", targetNames(targets))
+		fmt.Fprintln(out, "================================================")
 
-			if !exists {
-				fmt.Println("  → Creating GitHub repo...")
-				err = githubClient.CreateRepo(github.CreateRepoRequest{
-					Name:     repoName,
-					Private:  privateFlag,
-					AutoInit: false,
-				})
-				if err != nil {
-					return fmt.Errorf("failed to create GitHub repo: %w", err)
-				}
-				fmt.Println("  ✓ GitHub repo created")
-			} else {
-				fmt.Println("  ✓ GitHub repo already exists")
-			}
-		} else {
-			fmt.Println("\n1. Checking GitLab...")
-			exists, err = gitlabClient.RepoExists(cfg.GitLab.Username, repoName)
+		// Offer to delete what this run created if a later step fails
+		var undo rollback
+		defer func() {
 			if err != nil {
-				return fmt.Errorf("failed to check GitLab: %w", err)
-			}
-
-			if !exists {
-				fmt.Println("  → Creating GitLab repo...")
-				visibility := "public"
-				if privateFlag {
-					visibility = "private"
-				}
-				err = gitlabClient.CreateRepo(gitlab.CreateRepoRequest{
-					Name:       repoName,
-					Visibility: visibility,
-				})
-				if err != nil {
-					return fmt.Errorf("failed to create GitLab repo: %w", err)
-				}
-				fmt.Println("  ✓ GitLab repo created")
-			} else {
-				fmt.Println("  ✓ GitLab repo already exists")
+				undo.offer(cmd.Context(), createRollback)
 			}
+		}()
+
+		// 1. Create on the mirror targets
+		fmt.Fprintln(out, "\n1. Checking mirror targets...")
+		results = ensureTargetRepos(cmd.Context(), targets, repoName, private)
+		undo.recordTargetRepos(results, repoName)
+		if len(succeededTargets(results)) == 0 {
+			return targetsError(results)
 		}
 
 		// 2. Create on Gitea
-		fmt.Println("\n2. Checking Gitea...")
-		exists, err = giteaClient.RepoExists(cfg.Gitea.Username, repoName)
+		fmt.Fprintln(out, "\n2. Checking Gitea...")
+		exists, err := giteaClient.RepoExists(cmd.Context(), cfg.Gitea.RepoOwner(), repoName)
 		if err != nil {
-			return fmt.Errorf("failed to check Gitea: %w", err)
+			return fmt.Errorf("failed to check Gitea: %w", withHint(err))
 		}
+		result.URL = giteaWebURL(cfg, repoName)
 
 		if !exists {
-			fmt.Println("  → Creating Gitea repo...")
-			err = giteaClient.CreateRepo(gitea.CreateRepoRequest{
+			fmt.Fprintln(out, "  → Creating Gitea repo...")
+			err = createGiteaRepo(cmd.Context(), giteaClient, cfg, gitea.CreateRepoRequest{
 				Name:     repoName,
-				Private:  privateFlag,
+				Private:  private,
 				AutoInit: false,
 			})
-			if err != nil {
-				return fmt.Errorf("failed to create Gitea repo: %w", err)
+			switch {
+			case apierror.IsConflict(err):
+				// Created since the check, e.g. by a concurrent run
+				exists = true
+			case err != nil:
+				return fmt.Errorf("failed to create Gitea repo: %w", withHint(err))
+			default:
+				fmt.Fprintln(out, "  ✓ Gitea repo created")
+				result.Gitea = stateCreated
+				undo.record(fmt.Sprintf("Gitea repo %s", giteaWebURL(cfg, repoName)), func(ctx context.Context) error {
+					return giteaClient.DeleteRepo(ctx, cfg.Gitea.RepoOwner(), repoName)
+				})
 			}
-			fmt.Println("  ✓ Gitea repo created")
-		} else {
-			fmt.Println("  ✓ Gitea repo already exists")
+		}
+		if exists {
+			fmt.Fprintln(out, "  ✓ Gitea repo already exists")
+			result.Gitea = stateExisted
 		}
 
-		// 3. Set up push mirror
-		if useGitHub {
-			fmt.Println("\n3. Setting up GitHub mirror...")
-			err = giteaClient.AddPushMirror(cfg.Gitea.Username, repoName, gitea.PushMirrorRequest{
-				RemoteAddress:  fmt.Sprintf("https://github.com/%s/%s.git", cfg.GitHub.Username, repoName),
-				RemotePassword: cfg.GitHub.Token,
-				RemoteUsername: cfg.GitHub.Username,
-				SyncOnCommit:   true,
-				Interval:       "8h",
-			})
-			if err != nil {
-				return fmt.Errorf("failed to set up mirror: %w", err)
-			}
-			fmt.Println("  ✓ Mirror configured")
-		} else {
-			fmt.Println("\n3. Setting up GitLab mirror...")
-			gitlabURL := cfg.GitLab.URL
-			if gitlabURL == "" {
-				gitlabURL = "https://gitlab.com"
-			}
-			err = giteaClient.AddPushMirror(cfg.Gitea.Username, repoName, gitea.PushMirrorRequest{
-				RemoteAddress:  fmt.Sprintf("%s/%s/%s.git", gitlabURL, cfg.GitLab.Username, repoName),
-				RemotePassword: cfg.GitLab.Token,
-				RemoteUsername: cfg.GitLab.Username,
-				SyncOnCommit:   true,
-				Interval:       "8h",
-			})
-			if err != nil {
-				return fmt.Errorf("failed to set up mirror: %w", err)
-			}
-			fmt.Println("  ✓ Mirror configured")
+		// 3. Set up push mirrors
+		fmt.Fprintln(out, "\n3. Setting up push mirrors...")
+		opts := defaultMirrorOptions
+		opts.KeepExisting = true
+		addPushMirrors(cmd.Context(), out, giteaClient, cfg.Gitea.RepoOwner(), repoName, opts, results)
+		if exists {
+			undo.recordPushMirrors(giteaClient, cfg.Gitea.RepoOwner(), repoName, opts, results)
 		}
 
 		// 4. Initialize repo
-		fmt.Println("\n4. Initializing repository...")
+		fmt.Fprintln(out, "\n4. Initializing repository...")
 		tempDir, err := os.MkdirTemp("", "gitea-sync-*")
 		if err != nil {
 			return err
 		}
 		defer os.RemoveAll(tempDir)
 
-		if err := initRepo(tempDir, repoName, cfg); err != nil {
+		if err := initRepo(cmd.Context(), tempDir, repoName, cfg, succeededTargets(results)); err != nil {
 			return err
 		}
 
 		// 5. Pull the repo locally
-		fmt.Println("\n5. Pulling repository to current directory...")
-		if err := pullRepo(repoName, cfg); err != nil {
+		fmt.Fprintln(out, "\n5. Pulling repository to current directory...")
+		if err := pullRepo(cmd.Context(), repoName, cfg); err != nil {
 			return err
 		}
+		result.Path, _ = filepath.Abs(repoName)
 
 		// 6. Done!
-		fmt.Println("\n================================================")
-		fmt.Println("✓ Repository fully initialized and ready!")
-		fmt.Println("================================================")
-		fmt.Printf("\nRepository URLs:\n")
-		fmt.Printf("  Gitea:  %s/%s/%s\n", cfg.Gitea.URL, cfg.Gitea.Username, repoName)
-		if useGitHub {
-			fmt.Printf("  GitHub: https://github.com/%s/%s\n", cfg.GitHub.Username, repoName)
-		} else {
-			gitlabURL := cfg.GitLab.URL
-			if gitlabURL == "" {
-				gitlabURL = "https://gitlab.com"
-			}
-			fmt.Printf("  GitLab: %s/%s/%s\n", gitlabURL, cfg.GitLab.Username, repoName)
+		fmt.Fprintln(out, "\n================================================")
+		fmt.Fprintln(out, "✓ Repository fully initialized and ready!")
+		fmt.Fprintln(out, "================================================")
+		fmt.Fprintf(out, "\nRepository URLs:\n")
+		fmt.Fprintf(out, "  Gitea:  %s\n", giteaWebURL(cfg, repoName))
+		printTargetURLs(results, repoName)
+		fmt.Fprintf(out, "\nLocal directory: ./%s\n", repoName)
+		fmt.Fprintln(out, "\nThe repo is initialized with:")
+		fmt.Fprintln(out, "  • README.md")
+		fmt.Fprintln(out, "  • .gitignore")
+		fmt.Fprintln(out, "  • Initial commit")
+		fmt.Fprintln(out, "================================================")
+
+		// The Gitea repository serves the targets that worked, so only the
+		// resources of the failed targets are offered for deletion
+		err = targetsError(results)
+		if err != nil {
+			undo.retainFailed(results)
 		}
-		fmt.Printf("\nLocal directory: ./%s\n", repoName)
-		fmt.Println("\nThe repo is initialized with:")
-		fmt.Println("  • README.md")
-		fmt.Println("  • .gitignore")
-		fmt.Println("  • Initial commit")
-		fmt.Println("================================================")
-
-		return nil
+		return err
 	},
 }
 
-func initRepo(tempDir, repoName string, cfg *config.Config) error {
+func initRepo(ctx context.Context, tempDir, repoName string, cfg *config.Config, targets []forge.Provider) error {
 	// Initialize git
-	cmd := exec.Command("git", "init", "-b", "main")
+	cmd := exec.CommandContext(ctx, "git", "init", "-b", "main")
 	cmd.Dir = tempDir
-	if err := cmd.Run(); err != nil {
+	if err := runGit(cmd); err != nil {
 		return fmt.Errorf("failed to init git: %w", err)
 	}
-	fmt.Println("  ✓ Git initialized")
+	fmt.Fprintln(out, "  ✓ Git initialized")
 
 	// Create README
 	readme := fmt.Sprintf("# %s\n\nRepository created on %s\n", repoName, time.Now().Format("2006-01-02"))
 	if err := os.WriteFile(filepath.Join(tempDir, "README.md"), []byte(readme), 0644); err != nil {
 		return err
 	}
-	fmt.Println("  ✓ README.md created")
+	fmt.Fprintln(out, "  ✓ README.md created")
 
 	// Create .gitignore
 	gitignore := `# Common ignores
@@ -247,66 +205,72 @@ __pycache__/
 	if err := os.WriteFile(filepath.Join(tempDir, ".gitignore"), []byte(gitignore), 0644); err != nil {
 		return err
 	}
-	fmt.Println("  ✓ .gitignore created")
+	fmt.Fprintln(out, "  ✓ .gitignore created")
 
 	// Initial commit
-	cmd = exec.Command("git", "add", ".")
+	cmd = exec.CommandContext(ctx, "git", "add", ".")
 	cmd.Dir = tempDir
-	if err := cmd.Run(); err != nil {
+	if err := runGit(cmd); err != nil {
 		return fmt.Errorf("failed to add files: %w", err)
 	}
 
-	cmd = exec.Command("git", "commit", "-m", "init")
+	cmd = exec.CommandContext(ctx, "git", "commit", "-m", "init")
 	cmd.Dir = tempDir
-	if err := cmd.Run(); err != nil {
+	if err := runGit(cmd); err != nil {
 		return fmt.Errorf("failed to commit: %w", err)
 	}
-	fmt.Println("  ✓ Initial commit created")
+	fmt.Fprintln(out, "  ✓ Initial commit created")
 
 	// Push to Gitea
-	remoteURL := fmt.Sprintf("http://%s:%s@%s/%s/%s.git",
-		cfg.Gitea.Username,
-		cfg.Gitea.Token,
-		cfg.Gitea.URL[7:], // Remove http://
-		cfg.Gitea.Username,
-		repoName)
-
-	cmd = exec.Command("git", "remote", "add", "origin", remoteURL)
+	cmd = exec.CommandContext(ctx, "git", "remote", "add", "origin", giteaRemoteURL(cfg, repoName))
 	cmd.Dir = tempDir
-	if err := cmd.Run(); err != nil {
+	if err := runGit(cmd); err != nil {
 		return fmt.Errorf("failed to add remote: %w", err)
 	}
 
-	cmd = exec.Command("git", "push", "-u", "origin", "main")
+	if err := configureGiteaGit(ctx, tempDir, cfg); err != nil {
+		return err
+	}
+
+	cmd = exec.CommandContext(ctx, "git", "push", "-u", "origin", "main")
 	cmd.Dir = tempDir
-	if err := cmd.Run(); err != nil {
+	if err := runGit(cmd); err != nil {
 		return fmt.Errorf("failed to push: %w", err)
 	}
-	fmt.Println("  ✓ Pushed to Gitea")
-	fmt.Println("  ✓ Mirroring to GitHub...")
-	time.Sleep(2 * time.Second) // Give mirror time to sync
+	fmt.Fprintln(out, "  ✓ Pushed to Gitea")
+	fmt.Fprintf(out, "  ✓ Mirroring to %s...\n", targetNames(targets))
+	// Give the mirror time to sync
+	select {
+	case <-time.After(2 * time.Second):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 
 	return nil
 }
 
-func pullRepo(repoName string, cfg *config.Config) error {
-	// Clone the repo to current directory
-	cloneURL := fmt.Sprintf("%s/%s/%s.git", cfg.Gitea.URL, cfg.Gitea.Username, repoName)
+func pullRepo(ctx context.Context, repoName string, cfg *config.Config) error {
+	// Clone the repo to current directory, keeping the credential helper
+	cloneArgs := append([]string{"clone"}, giteaCloneArgs(cfg)...)
+	cloneArgs = append(cloneArgs, giteaRemoteURL(cfg, repoName))
 
-	cmd := exec.Command("git", "clone", cloneURL)
-	cmd.Stdout = os.Stdout
+	cmd := exec.CommandContext(ctx, "git", cloneArgs...)
+	cmd.Stdout = out
 	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
+	if err := runGit(cmd); err != nil {
 		return fmt.Errorf("failed to clone repo: %w", err)
 	}
-	fmt.Printf("  ✓ Repository cloned to ./%s\n", repoName)
+	fmt.Fprintf(out, "  ✓ Repository cloned to ./%s\n", repoName)
 
 	return nil
 }
 
 func init() {
 	createCmd.Flags().BoolVarP(&privateFlag, "private", "p", false, "Make the repository private")
-	createCmd.Flags().BoolVar(&useGitLab, "gitlab", false, "Mirror to GitLab instead of GitHub")
-	createCmd.Flags().BoolVar(&useGitHub, "github", false, "Mirror to GitHub (default)")
+	createCmd.Flags().BoolVar(&useGitLab, "gitlab", false, "Mirror to GitLab (same as --target gitlab)")
+	createCmd.Flags().BoolVar(&useGitHub, "github", false, "Mirror to GitHub (same as --target github)")
+	addTargetFlag(createCmd, &createTargets)
+	addOwnerFlag(createCmd, &createOwner)
+	createCmd.Flags().BoolVar(&createRollback, "rollback", false, "On failure, delete the repositories and mirrors this run created without asking")
 	rootCmd.AddCommand(createCmd)
 }
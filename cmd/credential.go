@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/Papiermond/gitea-sync/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var credentialCmd = &cobra.Command{
+	Use:   "credential",
+	Short: "Git credential helper serving the Gitea token from the config",
+	Long: `Git credential helper serving the Gitea token from the config.
+
+'gitea-sync add' and 'gitea-sync create' configure this helper for the
+Gitea host in the repositories they set up, so the token never ends up in
+remote URLs, .git/config, shell history or process lists.
+
+To use the helper in another repository:
+  git config credential.<gitea-url>.helper '!gitea-sync credential'
+
+Repositories set up by older versions have the token embedded in their
+remote URL. Strip it and configure the helper with:
+  gitea-sync credential migrate [path...]`,
+}
+
+var credentialGetCmd = &cobra.Command{
+	Use:    "get",
+	Short:  "Answer a git credential request (called by git)",
+	Args:   cobra.NoArgs,
+	Hidden: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		attrs, err := readCredentialRequest(os.Stdin)
+		if err != nil {
+			return err
+		}
+
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		endpoint, err := cfg.Gitea.Endpoint()
+		if err != nil {
+			return err
+		}
+
+		// Only answer for the Gitea host, and only for the configured user
+		if attrs["protocol"] != endpoint.Scheme || !strings.EqualFold(attrs["host"], endpoint.HostPort()) {
+			return nil
+		}
+		if username := attrs["username"]; username != "" && username != cfg.Gitea.Username {
+			return nil
+		}
+
+		token, err := cfg.Gitea.Resolve("gitea")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("username=%s\n", cfg.Gitea.Username)
+		fmt.Printf("password=%s\n", token)
+		return nil
+	},
+}
+
+// storeAndEraseCmd accepts the store and erase actions. The token lives in
+// the config, so there is nothing to store or erase.
+func storeAndEraseCmd(action string) *cobra.Command {
+	return &cobra.Command{
+		Use:    action,
+		Short:  fmt.Sprintf("Ignore a git credential %s request (called by git)", action),
+		Args:   cobra.NoArgs,
+		Hidden: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, err := io.Copy(io.Discard, os.Stdin)
+			return err
+		},
+	}
+}
+
+var credentialMigrateCmd = &cobra.Command{
+	Use:   "migrate [path...]",
+	Short: "Strip Gitea tokens from git remotes and configure the credential helper",
+	Long: `Strip Gitea tokens from the remote URLs of existing repositories and
+configure the gitea-sync credential helper instead.
+
+If no path is provided, uses the current directory.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			args = []string{"."}
+		}
+
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		failed := 0
+		for _, path := range args {
+			absPath, err := filepath.Abs(path)
+			if err != nil {
+				return fmt.Errorf("failed to get absolute path: %w", err)
+			}
+			fmt.Fprintf(out, "%s\n", absPath)
+			err = nil
+			if !isGitRepo(absPath) {
+				err = fmt.Errorf("not a git repository")
+				fmt.Fprintln(out, "  ✗ Not a git repository")
+			} else if err = migrateRemotes(cmd.Context(), absPath, cfg); err != nil {
+				fmt.Fprintf(out, "  ✗ %v\n", err)
+			}
+			if err != nil {
+				failed++
+			}
+			if jsonOutput() {
+				printJSON(struct {
+					Path  string       `json:"path"`
+					Error *errorResult `json:"error,omitempty"`
+				}{absPath, newErrorResult(err)})
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("migration failed for %d of %d repositories", failed, len(args))
+		}
+		return nil
+	},
+}
+
+// readCredentialRequest parses the key=value lines git sends to a helper.
+func readCredentialRequest(r io.Reader) (map[string]string, error) {
+	attrs := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if ok {
+			attrs[key] = value
+		}
+	}
+	return attrs, scanner.Err()
+}
+
+// credentialHelper returns the helper command git should run, pointing at
+// the running gitea-sync binary, the config file given with --config and the
+// profile holding the token.
+func credentialHelper(profile string) string {
+	exe, err := os.Executable()
+	if err != nil {
+		exe = "gitea-sync"
+	}
+	// Git runs "!" helpers through the shell
+	helper := "!" + shellQuote(exe)
+	if config.PathOverride != "" {
+		// ConfigPath makes the path absolute, as git runs the helper in
+		// the repository
+		if path, err := config.ConfigPath(); err == nil {
+			helper += " --config " + shellQuote(path)
+		}
+	}
+	return fmt.Sprintf("%s --profile %s credential", helper, shellQuote(profile))
+}
+
+// migrateRemotes removes credentials from every Gitea remote in repoPath
+// and configures the credential helper if there is any Gitea remote.
+func migrateRemotes(ctx context.Context, repoPath string, cfg *config.Config) error {
+	cmd := exec.CommandContext(ctx, "git", "remote")
+	cmd.Dir = repoPath
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to list remotes: %w", err)
+	}
+
+	found := false
+	for _, remote := range strings.Fields(string(output)) {
+		cmd = exec.CommandContext(ctx, "git", "remote", "get-url", remote)
+		cmd.Dir = repoPath
+		urlOutput, err := cmd.Output()
+		if err != nil {
+			return fmt.Errorf("failed to get URL of remote %s: %w", remote, err)
+		}
+
+		remoteURL := strings.TrimSpace(string(urlOutput))
+		if !isGiteaRemote(remoteURL, cfg) {
+			continue
+		}
+		found = true
+
+		parsed, err := url.Parse(remoteURL)
+		if err != nil || parsed.User == nil {
+			fmt.Fprintf(out, "  ✓ Remote '%s' has no embedded credentials\n", remote)
+			continue
+		}
+
+		parsed.User = nil
+		cmd = exec.CommandContext(ctx, "git", "remote", "set-url", remote, parsed.String())
+		cmd.Dir = repoPath
+		if err := runGit(cmd); err != nil {
+			return fmt.Errorf("failed to update remote %s: %w", remote, err)
+		}
+		fmt.Fprintf(out, "  ✓ Removed credentials from remote '%s'\n", remote)
+	}
+
+	if !found {
+		fmt.Fprintln(out, "  ℹ No Gitea remote found")
+		return nil
+	}
+
+	if err := configureGiteaGit(ctx, repoPath, cfg); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "  ✓ Credential helper configured")
+	return nil
+}
+
+func init() {
+	credentialCmd.AddCommand(credentialGetCmd)
+	credentialCmd.AddCommand(storeAndEraseCmd("store"))
+	credentialCmd.AddCommand(storeAndEraseCmd("erase"))
+	credentialCmd.AddCommand(credentialMigrateCmd)
+	rootCmd.AddCommand(credentialCmd)
+}
@@ -0,0 +1,428 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Papiermond/gitea-sync/internal/apierror"
+	"github.com/Papiermond/gitea-sync/internal/config"
+	"github.com/Papiermond/gitea-sync/internal/forge"
+	"github.com/spf13/cobra"
+)
+
+// minGitVersion is the oldest git that supports 'git init -b'.
+var minGitVersion = [2]int{2, 28}
+
+// doctorProbeScopes enables the write request that tests the scopes of the
+// Gitea token, see gitea.Client.CheckRepoScope.
+var doctorProbeScopes bool
+
+// tokenExpiryWarning is how long before its expiry a token is reported.
+const tokenExpiryWarning = 14 * 24 * time.Hour
+
+// Outcomes of a doctor check.
+const (
+	checkOK      = "ok"
+	checkWarning = "warning"
+	checkFailed  = "failed"
+	checkSkipped = "skipped"
+)
+
+// doctorCheck is the outcome of one doctor check.
+type doctorCheck struct {
+	Component string `json:"component"`
+	Check     string `json:"check"`
+	Status    string `json:"status"`
+	Message   string `json:"message"`
+	// Hint tells how to fix a warning or failure.
+	Hint string `json:"hint,omitempty"`
+}
+
+// doctorReport collects the checks of a doctor run and prints each one as
+// it is made.
+type doctorReport struct {
+	Config string        `json:"config"`
+	Checks []doctorCheck `json:"checks"`
+
+	component string
+}
+
+// section starts the checks of component.
+func (r *doctorReport) section(component string) {
+	r.component = component
+	fmt.Fprintf(out, "\n%s\n", component)
+}
+
+func (r *doctorReport) add(check, status, message, hint string) {
+	r.Checks = append(r.Checks, doctorCheck{
+		Component: r.component,
+		Check:     check,
+		Status:    status,
+		Message:   message,
+		Hint:      hint,
+	})
+
+	symbol := map[string]string{checkOK: "✓", checkWarning: "⚠", checkFailed: "✗", checkSkipped: "ℹ"}[status]
+	fmt.Fprintf(out, "  %s %s\n", symbol, message)
+	if hint != "" {
+		fmt.Fprintf(out, "    → %s\n", hint)
+	}
+}
+
+func (r *doctorReport) ok(check, message string) {
+	r.add(check, checkOK, message, "")
+}
+
+func (r *doctorReport) warn(check, message, hint string) {
+	r.add(check, checkWarning, message, hint)
+}
+
+func (r *doctorReport) fail(check, message, hint string) {
+	r.add(check, checkFailed, message, hint)
+}
+
+func (r *doctorReport) skip(check, message string) {
+	r.add(check, checkSkipped, message, "")
+}
+
+// failures returns the number of failed checks.
+func (r *doctorReport) failures() int {
+	n := 0
+	for _, check := range r.Checks {
+		if check.Status == checkFailed {
+			n++
+		}
+	}
+	return n
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the configuration, connectivity and tokens",
+	Long: `Check the configuration, connectivity and tokens.
+
+Loads the config file and, for Gitea and every configured mirror target,
+checks that the server is reachable, that the token is valid and belongs to
+the configured user, and that it has the scopes gitea-sync needs. Also checks
+that git is installed and recent enough.
+
+Gitea does not report the scopes of a token. With --probe-scopes, doctor
+tests them by sending a repository creation without a name, which Gitea
+rejects before creating anything; without it the Gitea scopes are skipped.
+
+Every failed check comes with a hint on how to fix it. The command exits with
+a non-zero status when any check fails; warnings do not fail it.
+
+Examples:
+  gitea-sync doctor
+  gitea-sync doctor --probe-scopes
+  gitea-sync doctor --output json`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		report := &doctorReport{Checks: []doctorCheck{}}
+
+		cfg := checkConfig(report)
+		checkGit(ctx, report)
+		if cfg != nil {
+			checkGitea(ctx, report, cfg)
+			checkTargets(ctx, report, cfg)
+		}
+
+		if jsonOutput() {
+			if err := printJSON(report); err != nil {
+				return err
+			}
+		}
+
+		if n := report.failures(); n > 0 {
+			return fmt.Errorf("%d check(s) failed", n)
+		}
+		fmt.Fprintln(out, "\n✓ Everything looks good")
+		return nil
+	},
+}
+
+// checkConfig loads the config file and checks its permissions. It returns
+// nil if the config cannot be loaded.
+func checkConfig(report *doctorReport) *config.Config {
+	report.section("Config")
+
+	path, err := config.ConfigPath()
+	if err != nil {
+		report.fail("load", err.Error(), "Set the HOME environment variable")
+		return nil
+	}
+	report.Config = path
+
+	cfg, err := loadConfig()
+	if err != nil {
+		hint := fmt.Sprintf("Fix %s, or run 'gitea-sync init' to write a new one", path)
+		if _, statErr := os.Stat(path); errors.Is(statErr, os.ErrNotExist) {
+			hint = "Run 'gitea-sync init' to create it"
+		}
+		report.fail("load", err.Error(), hint)
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		report.ok("load", "No config file, using the environment and flags")
+		return cfg
+	}
+	report.ok("load", fmt.Sprintf("Loaded profile %s of %s", cfg.Profile, path))
+
+	if info.Mode().Perm()&0077 != 0 {
+		report.warn("permissions", fmt.Sprintf("%s is readable by other users (mode %04o)", path, info.Mode().Perm()),
+			fmt.Sprintf("Run 'chmod 600 %s', the file contains tokens", path))
+	}
+	return cfg
+}
+
+var gitVersionPattern = regexp.MustCompile(`(\d+)\.(\d+)`)
+
+// checkGit checks that git is installed and recent enough.
+func checkGit(ctx context.Context, report *doctorReport) {
+	report.section("git")
+
+	path, err := exec.LookPath("git")
+	if err != nil {
+		report.fail("installed", "git not found in PATH", "Install git from https://git-scm.com/downloads")
+		return
+	}
+
+	output, err := exec.CommandContext(ctx, path, "--version").Output()
+	if err != nil {
+		report.fail("version", fmt.Sprintf("%s --version failed: %v", path, err), "Reinstall git")
+		return
+	}
+	version := strings.TrimSpace(string(output))
+	match := gitVersionPattern.FindStringSubmatch(version)
+	if match == nil {
+		report.warn("version", fmt.Sprintf("Unrecognized version %q", version),
+			fmt.Sprintf("Make sure git %d.%d or newer is installed", minGitVersion[0], minGitVersion[1]))
+		return
+	}
+	major, _ := strconv.Atoi(match[1])
+	minor, _ := strconv.Atoi(match[2])
+	if major < minGitVersion[0] || (major == minGitVersion[0] && minor < minGitVersion[1]) {
+		report.fail("version", fmt.Sprintf("%s is too old", version),
+			fmt.Sprintf("Upgrade to git %d.%d or newer, which 'create' needs for 'git init -b'", minGitVersion[0], minGitVersion[1]))
+		return
+	}
+	report.ok("version", version)
+}
+
+// checkGitea checks that Gitea is reachable and that the token belongs to
+// the configured user and may create repositories, in the configured
+// organization if there is one.
+func checkGitea(ctx context.Context, report *doctorReport, cfg *config.Config) {
+	report.section("Gitea")
+
+	giteaClient, err := newGiteaClient(cfg)
+	if err != nil {
+		report.fail("connect", err.Error(), "Fix the gitea section of the config file")
+		return
+	}
+
+	version, err := giteaClient.Version(ctx)
+	if err != nil {
+		report.fail("reachable", fmt.Sprintf("Cannot reach %s: %v", cfg.Gitea.URL, err), reachHint("gitea.url", err))
+		return
+	}
+	report.ok("reachable", fmt.Sprintf("Reachable at %s (Gitea %s)", cfg.Gitea.URL, version))
+
+	endpoint, _ := cfg.Gitea.Endpoint()
+	tokenURL := endpoint.BaseURL() + "/user/settings/applications"
+	user, err := giteaClient.CurrentUser(ctx)
+	if err != nil {
+		report.fail("token", tokenError(err), tokenHint("gitea.token", tokenURL, err))
+		return
+	}
+	checkUsername(report, "gitea.username", cfg.Gitea.Username, user.Login)
+
+	if cfg.Gitea.IsOrgOwner() {
+		if err := checkGiteaOwner(ctx, giteaClient, cfg); err != nil {
+			report.fail("owner", err.Error(), "Fix gitea.owner, or ask an owner of the organization for a team that may create repositories")
+		} else {
+			report.ok("owner", fmt.Sprintf("May create repositories in the organization %s", cfg.Gitea.Owner))
+		}
+	}
+
+	if !doctorProbeScopes {
+		report.skip("scopes", "Gitea does not report token scopes; rerun with --probe-scopes to test write:repository")
+		return
+	}
+	if dryRun {
+		report.skip("scopes", "Token scopes not checked in a dry run")
+		return
+	}
+	err = giteaClient.CheckRepoScope(ctx)
+	switch {
+	case apierror.IsAuth(err):
+		report.fail("scopes", fmt.Sprintf("Token may not create repositories: %v", err),
+			fmt.Sprintf("Create a token with the write:repository scope at %s and update gitea.token", tokenURL))
+	case err != nil:
+		report.warn("scopes", fmt.Sprintf("Could not check the token scopes: %v", err), "")
+	default:
+		report.ok("scopes", "Token may create repositories")
+	}
+}
+
+// checkTargets checks every mirror target that has credentials configured
+// or is a default target.
+func checkTargets(ctx context.Context, report *doctorReport, cfg *config.Config) {
+	httpClient, err := newHTTPClient(cfg, nil)
+	if err != nil {
+		report.section("Mirror targets")
+		report.fail("connect", err.Error(), "Fix the http section of the config file")
+		return
+	}
+
+	for _, name := range forge.Names() {
+		target, err := forge.New(name, cfg, httpClient)
+		if err != nil {
+			// Only the default targets have to be configured, but a
+			// configured token must be readable
+			switch {
+			case hasTokenSource(cfg, name):
+				report.section(name)
+				report.fail("configured", err.Error(), fmt.Sprintf("Fix the %s section of the config file", name))
+			case slices.Contains(cfg.Targets, name):
+				report.section(name)
+				report.fail("configured", err.Error(),
+					fmt.Sprintf("Add %s credentials with 'gitea-sync init', or remove %s from targets", name, name))
+			}
+			continue
+		}
+		report.section(target.DisplayName())
+
+		verifier, ok := target.(forge.Verifier)
+		if !ok {
+			report.skip("token", fmt.Sprintf("%s tokens cannot be checked", target.DisplayName()))
+			continue
+		}
+		checkTarget(ctx, report, target, verifier)
+	}
+}
+
+// hasTokenSource reports whether a token, token command, token file or
+// keyring account is configured in section.
+func hasTokenSource(cfg *config.Config, section string) bool {
+	for _, key := range config.Keys() {
+		if strings.HasPrefix(key, section+".token") && cfg.Get(key) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTarget checks that target is reachable and that its token belongs
+// to the configured user, has the needed scopes and does not expire soon.
+func checkTarget(ctx context.Context, report *doctorReport, target forge.Provider, verifier forge.Verifier) {
+	tokenKey := target.Name() + ".token"
+	account, err := verifier.Account(ctx)
+	if _, ok := apierror.As(err); err != nil && !ok {
+		report.fail("reachable", fmt.Sprintf("Cannot reach %s: %v", target.DisplayName(), err), reachHint("the "+target.DisplayName()+" URL", err))
+		return
+	}
+	report.ok("reachable", "Reachable")
+	if err != nil {
+		report.fail("token", tokenError(err), tokenHint(tokenKey, verifier.TokenURL(), err))
+		return
+	}
+
+	username, _ := target.Credentials()
+	checkUsername(report, target.Name()+".username", username, account.Username)
+
+	switch {
+	case account.Scopes == nil:
+		report.skip("scopes", fmt.Sprintf("%s does not report the scopes of this token", target.DisplayName()))
+	case len(account.Missing) > 0:
+		report.fail("scopes", fmt.Sprintf("Token lacks the %s scope(s)", strings.Join(account.Missing, ", ")),
+			fmt.Sprintf("Create a token with the %s scope(s) at %s and update %s", strings.Join(account.Missing, ", "), verifier.TokenURL(), tokenKey))
+	default:
+		report.ok("scopes", fmt.Sprintf("Token scopes: %s", strings.Join(account.Scopes, ", ")))
+	}
+	if account.Scopes != nil {
+		for _, scope := range slices.Sorted(maps.Keys(account.MissingOptional)) {
+			report.warn("scopes", fmt.Sprintf("Token lacks the %s scope needed for %s", scope, account.MissingOptional[scope]),
+				fmt.Sprintf("Add the %s scope at %s to use %s", scope, verifier.TokenURL(), account.MissingOptional[scope]))
+		}
+	}
+
+	if !account.Expires.IsZero() {
+		until := time.Until(account.Expires)
+		switch {
+		case until <= 0:
+			report.fail("expiry", fmt.Sprintf("Token expired on %s", account.Expires.Format(time.DateOnly)),
+				fmt.Sprintf("Create a new token at %s and update %s", verifier.TokenURL(), tokenKey))
+		case until < tokenExpiryWarning:
+			report.warn("expiry", fmt.Sprintf("Token expires on %s", account.Expires.Format(time.DateOnly)),
+				fmt.Sprintf("Create a new token at %s and update %s", verifier.TokenURL(), tokenKey))
+		default:
+			report.ok("expiry", fmt.Sprintf("Token expires on %s", account.Expires.Format(time.DateOnly)))
+		}
+	}
+}
+
+// checkUsername compares the configured username with the user of the
+// token. Forges compare usernames case-insensitively.
+func checkUsername(report *doctorReport, key, configured, actual string) {
+	if !strings.EqualFold(configured, actual) {
+		report.fail("username", fmt.Sprintf("Token belongs to %s, but %s is %q", actual, key, configured),
+			fmt.Sprintf("Set %s to %q, or use a token of %s", key, actual, configured))
+		return
+	}
+	report.ok("username", fmt.Sprintf("Token authenticates as %s", actual))
+}
+
+// reachHint returns what to do about a server that cannot be reached at
+// the URL described by url, e.g. "gitea.url".
+func reachHint(url string, err error) string {
+	var dnsErr *net.DNSError
+	var certErr *tls.CertificateVerificationError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Sprintf("Check %s and your network, or raise --timeout", url)
+	case errors.As(err, &certErr) && url == "gitea.url":
+		return "Set gitea.ca_file to the CA bundle that signed the server certificate"
+	case errors.As(err, &certErr):
+		return "Add the CA that signed the server certificate to the system trust store"
+	case errors.As(err, &dnsErr):
+		return fmt.Sprintf("Check the host name in %s and your DNS settings", url)
+	}
+	return fmt.Sprintf("Check %s and that the server is running", url)
+}
+
+// tokenError describes the failed check of a token.
+func tokenError(err error) string {
+	if apierror.IsAuth(err) {
+		return fmt.Sprintf("Token rejected: %v", err)
+	}
+	return fmt.Sprintf("Could not verify the token: %v", err)
+}
+
+// tokenHint returns what to do about a token that the forge rejected.
+func tokenHint(tokenKey, tokenURL string, err error) string {
+	if apierror.IsRateLimited(err) {
+		return "Wait for the rate limit to reset and try again"
+	}
+	return fmt.Sprintf("Create a new token at %s and update %s (e.g. with 'gitea-sync init')", tokenURL, tokenKey)
+}
+
+func init() {
+	doctorCmd.Flags().BoolVar(&doctorProbeScopes, "probe-scopes", false, "Test the Gitea token scopes with a repository creation that Gitea rejects")
+	rootCmd.AddCommand(doctorCmd)
+}
@@ -0,0 +1,234 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strings"
+
+	"github.com/Papiermond/gitea-sync/internal/config"
+)
+
+// gitConfigEntry is one git config key and value.
+type gitConfigEntry struct {
+	key   string
+	value string
+}
+
+// giteaRemoteURL returns the clone URL of repoName on Gitea, without
+// credentials. The Gitea URL has been validated by config.Load.
+func giteaRemoteURL(cfg *config.Config, repoName string) string {
+	endpoint, err := cfg.Gitea.Endpoint()
+	if err != nil {
+		return cfg.Gitea.URL
+	}
+	return endpoint.CloneURL(cfg.Gitea.RepoOwner(), repoName)
+}
+
+// giteaWebURL returns the browser URL of repoName on Gitea.
+func giteaWebURL(cfg *config.Config, repoName string) string {
+	endpoint, err := cfg.Gitea.Endpoint()
+	if err != nil {
+		return cfg.Gitea.URL
+	}
+	return endpoint.RepoURL(cfg.Gitea.RepoOwner(), repoName)
+}
+
+// isGiteaRemote reports whether remote points at the configured Gitea host,
+// with or without credentials embedded.
+func isGiteaRemote(remote string, cfg *config.Config) bool {
+	remoteURL, err := url.Parse(remote)
+	if err != nil || remoteURL.Host == "" {
+		return false
+	}
+	endpoint, err := cfg.Gitea.Endpoint()
+	if err != nil {
+		return false
+	}
+	return endpoint.Matches(remoteURL)
+}
+
+// giteaGitConfig returns the git config a repository needs to talk to
+// Gitea: the credential helper and, for an internal TLS Gitea, the CA bundle
+// and client certificate. All entries are scoped to the Gitea URL.
+func giteaGitConfig(cfg *config.Config) []gitConfigEntry {
+	base := cfg.Gitea.URL
+	if endpoint, err := cfg.Gitea.Endpoint(); err == nil {
+		base = endpoint.BaseURL()
+	}
+
+	// The empty helper resets helpers from the global config, so the token
+	// is not copied into another credential store
+	entries := []gitConfigEntry{
+		{"credential." + base + ".helper", ""},
+		{"credential." + base + ".helper", credentialHelper(cfg.Profile)},
+	}
+	if cfg.Gitea.CAFile != "" {
+		entries = append(entries, gitConfigEntry{"http." + base + ".sslCAInfo", cfg.Gitea.CAFile})
+	}
+	if cfg.Gitea.ClientCert != "" {
+		entries = append(entries,
+			gitConfigEntry{"http." + base + ".sslCert", cfg.Gitea.ClientCert},
+			gitConfigEntry{"http." + base + ".sslKey", cfg.Gitea.ClientKey})
+	}
+	return entries
+}
+
+// runGit runs a git command that changes a repository. In a dry run the
+// command is printed instead.
+func runGit(cmd *exec.Cmd) error {
+	if dryRun {
+		dir := ""
+		if cmd.Dir != "" {
+			dir = " (in " + cmd.Dir + ")"
+		}
+		args := make([]string, len(cmd.Args))
+		for i, arg := range cmd.Args {
+			args[i] = shellQuote(arg)
+		}
+		fmt.Fprintf(out, "  [dry-run] %s%s\n", strings.Join(args, " "), dir)
+		return nil
+	}
+	return cmd.Run()
+}
+
+// shellQuote quotes arg for display if a shell would split or expand it.
+func shellQuote(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\$!*?;&|<>()`") {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// configureGiteaGit writes the Gitea git config into the repository at
+// repoPath, replacing earlier values of the same keys.
+func configureGiteaGit(ctx context.Context, repoPath string, cfg *config.Config) error {
+	seen := make(map[string]bool)
+	for _, entry := range giteaGitConfig(cfg) {
+		mode := "--replace-all"
+		if seen[entry.key] {
+			mode = "--add"
+		}
+		seen[entry.key] = true
+
+		cmd := exec.CommandContext(ctx, "git", "config", "--local", mode, entry.key, entry.value)
+		cmd.Dir = repoPath
+		if err := runGit(cmd); err != nil {
+			return fmt.Errorf("failed to set git config %s: %w", entry.key, err)
+		}
+	}
+	return nil
+}
+
+// giteaCloneArgs returns the "git clone" options that write the Gitea git
+// config into the new repository.
+func giteaCloneArgs(cfg *config.Config) []string {
+	var args []string
+	for _, entry := range giteaGitConfig(cfg) {
+		args = append(args, "-c", entry.key+"="+entry.value)
+	}
+	return args
+}
+
+// giteaRemotes are the remotes add may point at Gitea.
+var giteaRemotes = []string{"origin", "gitea"}
+
+// localGitState is the part of a repository's config that add changes: the
+// remotes that may point at Gitea and the Gitea git config.
+type localGitState struct {
+	repoPath string
+	// remotes maps the remote names to their URL, "" if missing.
+	remotes map[string]string
+	// config maps the Gitea git config keys to their values.
+	config map[string][]string
+}
+
+// saveGitState reads the remotes and Gitea git config of the repository at
+// repoPath, so that they can be restored when a run is rolled back.
+func saveGitState(ctx context.Context, repoPath string, cfg *config.Config) (*localGitState, error) {
+	state := &localGitState{
+		repoPath: repoPath,
+		remotes:  make(map[string]string),
+		config:   make(map[string][]string),
+	}
+	for _, name := range giteaRemotes {
+		value, err := readGitConfig(ctx, repoPath, "remote."+name+".url")
+		if err != nil {
+			return nil, err
+		}
+		if len(value) > 0 {
+			state.remotes[name] = value[0]
+		}
+	}
+	for _, entry := range giteaGitConfig(cfg) {
+		values, err := readGitConfig(ctx, repoPath, entry.key)
+		if err != nil {
+			return nil, err
+		}
+		state.config[entry.key] = values
+	}
+	return state, nil
+}
+
+// restore puts the saved remotes and Gitea git config back.
+func (s *localGitState) restore(ctx context.Context) error {
+	for _, name := range giteaRemotes {
+		current, err := readGitConfig(ctx, s.repoPath, "remote."+name+".url")
+		if err != nil {
+			return err
+		}
+		var args []string
+		switch old := s.remotes[name]; {
+		case old == "" && len(current) > 0:
+			args = []string{"remote", "remove", name}
+		case old != "" && len(current) == 0:
+			args = []string{"remote", "add", name, old}
+		case old != "" && current[0] != old:
+			args = []string{"remote", "set-url", name, old}
+		default:
+			continue
+		}
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = s.repoPath
+		if err := runGit(cmd); err != nil {
+			return fmt.Errorf("failed to restore remote %s: %w", name, err)
+		}
+	}
+
+	for key, values := range s.config {
+		// Exit status 5 means the key was not set
+		cmd := exec.CommandContext(ctx, "git", "config", "--local", "--unset-all", key)
+		cmd.Dir = s.repoPath
+		var exitErr *exec.ExitError
+		if err := runGit(cmd); err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 5) {
+			return fmt.Errorf("failed to restore git config %s: %w", key, err)
+		}
+		for _, value := range values {
+			cmd := exec.CommandContext(ctx, "git", "config", "--local", "--add", key, value)
+			cmd.Dir = s.repoPath
+			if err := runGit(cmd); err != nil {
+				return fmt.Errorf("failed to restore git config %s: %w", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// readGitConfig returns the values of key in the local config of the
+// repository at repoPath, or none if it is not set.
+func readGitConfig(ctx context.Context, repoPath, key string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, "git", "config", "--local", "--get-all", key)
+	cmd.Dir = repoPath
+	output, err := cmd.Output()
+	// Exit status 1 means the key is not set
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read git config %s: %w", key, err)
+	}
+	return strings.Split(strings.TrimSuffix(string(output), "\n"), "\n"), nil
+}
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/Papiermond/gitea-sync/internal/forge"
+	"github.com/Papiermond/gitea-sync/internal/gitea"
+	"github.com/spf13/cobra"
+)
+
+var (
+	importFrom            string
+	importUser            string
+	importFromOrg         string
+	importMatch           string
+	importExcludeForks    bool
+	importExcludeArchived bool
+	importVisibility      string
+	importInterval        string
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import --from <github|gitlab> [--user <name> | --from-org <name>]",
+	Short: "Import repositories from GitHub or GitLab as Gitea pull mirrors",
+	Long: `Import the repositories of a GitHub or GitLab account into Gitea as pull
+mirrors. Gitea clones every repository and keeps pulling new commits from
+it every --interval.
+
+Without --user or --from-org the repositories of the configured username
+on the source platform are imported. Repositories that already exist on
+Gitea are skipped. The mirrors are created in the Gitea organization set by
+gitea.owner, if any. The source token is handed to Gitea so that private repositories
+can be cloned; imported repositories keep their visibility.
+
+Examples:
+  gitea-sync import --from github
+  gitea-sync import --from github --from-org my-company --match 'api-*' --exclude-forks
+  gitea-sync import --from gitlab --from-org my-group/sub-group --visibility public`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if importUser != "" && importFromOrg != "" {
+			return fmt.Errorf("--user and --from-org cannot be used together")
+		}
+		if _, err := path.Match(importMatch, ""); err != nil {
+			return fmt.Errorf("invalid --match pattern %q: %w", importMatch, err)
+		}
+		switch importVisibility {
+		case "all", "public", "private":
+		default:
+			return fmt.Errorf("--visibility must be all, public or private, got %q", importVisibility)
+		}
+		if _, err := time.ParseDuration(importInterval); err != nil {
+			return fmt.Errorf("invalid --interval %q", importInterval)
+		}
+
+		// Load config
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		// Initialize clients
+		httpClient, err := newHTTPClient(cfg, nil)
+		if err != nil {
+			return err
+		}
+		source, err := forge.New(importFrom, cfg, httpClient)
+		if err != nil {
+			return err
+		}
+		lister, ok := source.(forge.Lister)
+		if !ok {
+			return fmt.Errorf("%s does not support listing repositories", source.DisplayName())
+		}
+		giteaClient, err := newGiteaClient(cfg)
+		if err != nil {
+			return err
+		}
+		if err := checkGiteaOwner(cmd.Context(), giteaClient, cfg); err != nil {
+			return err
+		}
+
+		username, token := source.Credentials()
+		owner, org := importUser, false
+		if importFromOrg != "" {
+			owner, org = importFromOrg, true
+		}
+		if owner == "" {
+			owner = username
+		}
+
+		fmt.Fprintln(out, "================================================")
+		fmt.Fprintf(out, "Importing from %s: %s\n", source.DisplayName(), owner)
+		fmt.Fprintln(out, "================================================")
+
+		fmt.Fprintf(out, "\nListing %s repositories...\n", source.DisplayName())
+		repos, err := lister.ListRepos(cmd.Context(), owner, org)
+		if err != nil {
+			return fmt.Errorf("failed to list %s repositories: %w", source.DisplayName(), err)
+		}
+		selected := filterImportRepos(repos)
+		fmt.Fprintf(out, "  ✓ %d repositories found, %d selected\n", len(repos), len(selected))
+
+		if len(selected) == 0 {
+			return nil
+		}
+
+		fmt.Fprintln(out, "\nCreating pull mirrors...")
+		imported, skipped := 0, 0
+		var failed []string
+		for _, repo := range selected {
+			result := &repoResult{Repo: repo.Name, URL: giteaWebURL(cfg, repo.Name), Source: repo.CloneURL}
+			exists, err := giteaClient.RepoExists(cmd.Context(), cfg.Gitea.RepoOwner(), repo.Name)
+			if err != nil {
+				err = fmt.Errorf("failed to check Gitea: %w", withHint(err))
+				fmt.Fprintf(out, "  ✗ %s: %v\n", repo.Name, err)
+				result.emit(err)
+				failed = append(failed, repo.Name)
+				continue
+			}
+			if exists {
+				fmt.Fprintf(out, "  ℹ %s already exists on Gitea, skipped\n", repo.Name)
+				result.Gitea = stateExisted
+				result.emit(nil)
+				skipped++
+				continue
+			}
+
+			err = giteaClient.Migrate(cmd.Context(), gitea.MigrateRepoRequest{
+				CloneAddr:      repo.CloneURL,
+				RepoName:       repo.Name,
+				RepoOwner:      cfg.Gitea.Owner,
+				Service:        source.Name(),
+				AuthUsername:   username,
+				AuthToken:      token,
+				Mirror:         true,
+				MirrorInterval: importInterval,
+				Private:        repo.Private,
+				Description:    repo.Description,
+			})
+			if err != nil {
+				fmt.Fprintf(out, "  ✗ %s: %v\n", repo.Name, err)
+				result.emit(err)
+				failed = append(failed, repo.Name)
+				continue
+			}
+			fmt.Fprintf(out, "  ✓ %s → %s\n", repo.Name, giteaWebURL(cfg, repo.Name))
+			result.Gitea = stateCreated
+			result.emit(nil)
+			imported++
+		}
+
+		fmt.Fprintln(out, "\n================================================")
+		fmt.Fprintf(out, "✓ Imported %d/%d repositories (%d already on Gitea)\n", imported, len(selected), skipped)
+		fmt.Fprintln(out, "================================================")
+
+		if len(failed) > 0 {
+			return fmt.Errorf("import failed for %d repositories: %v", len(failed), failed)
+		}
+		return nil
+	},
+}
+
+// filterImportRepos applies the --match, --exclude-* and --visibility
+// filters.
+func filterImportRepos(repos []forge.RemoteRepo) []forge.RemoteRepo {
+	var selected []forge.RemoteRepo
+	for _, repo := range repos {
+		if ok, _ := path.Match(importMatch, repo.Name); !ok {
+			continue
+		}
+		if importExcludeForks && repo.Fork {
+			continue
+		}
+		if importExcludeArchived && repo.Archived {
+			continue
+		}
+		if importVisibility != "all" && visibilityName(repo.Private) != importVisibility {
+			continue
+		}
+		selected = append(selected, repo)
+	}
+	return selected
+}
+
+func init() {
+	importCmd.Flags().StringVar(&importFrom, "from", "", "Platform to import from (github, gitlab)")
+	importCmd.Flags().StringVar(&importUser, "user", "", "Import the repositories of this user (default: configured username)")
+	importCmd.Flags().StringVar(&importFromOrg, "from-org", "", "Import the repositories of this organization or GitLab group")
+	importCmd.Flags().StringVar(&importMatch, "match", "*", "Only import repositories whose name matches this glob")
+	importCmd.Flags().BoolVar(&importExcludeForks, "exclude-forks", false, "Skip forked repositories")
+	importCmd.Flags().BoolVar(&importExcludeArchived, "exclude-archived", false, "Skip archived repositories")
+	importCmd.Flags().StringVar(&importVisibility, "visibility", "all", "Only import repositories with this visibility (all, public, private)")
+	importCmd.Flags().StringVar(&importInterval, "interval", "8h", "How often Gitea pulls from the source")
+	importCmd.MarkFlagRequired("from")
+	rootCmd.AddCommand(importCmd)
+}
@@ -2,100 +2,636 @@ package cmd
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"slices"
 	"strings"
 
+	"github.com/Papiermond/gitea-sync/internal/apierror"
 	"github.com/Papiermond/gitea-sync/internal/config"
+	"github.com/Papiermond/gitea-sync/internal/forge"
+	"github.com/Papiermond/gitea-sync/internal/keyring"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
+var (
+	initDefault  bool
+	initEdit     bool
+	initNoVerify bool
+	initJSON     bool
+	initStorage  string
+	// initTokenStdin maps sections to their --<section>-token-stdin flag.
+	initTokenStdin = make(map[string]*bool)
+)
+
+// Where init stores the tokens.
+const (
+	storeConfig  = "config"
+	storeKeyring = "keyring"
+	storeCommand = "command"
+	storeFile    = "file"
+)
+
+var tokenStorages = []string{storeConfig, storeKeyring, storeCommand, storeFile}
+
+// storageKeys maps the token storages to the setting holding the token.
+var storageKeys = map[string]string{
+	storeConfig:  "token",
+	storeKeyring: "token_keyring",
+	storeCommand: "token_cmd",
+	storeFile:    "token_file",
+}
+
+// keyringToken is a token init stores in the keyring.
+type keyringToken struct {
+	platform string
+	account  string
+	label    string
+	token    string
+}
+
+// initSection is a forge section of the config that init sets up.
+type initSection struct {
+	name     string // config section, e.g. "gitea"
+	platform string // display name, e.g. "Gitea"
+	// urlPrompt asks for the URL of the forge, empty if the forge has a
+	// fixed URL.
+	urlPrompt string
+	// optional sections are skipped when their URL is left empty.
+	optional bool
+}
+
+var initSections = []initSection{
+	{"gitea", "Gitea", "Gitea URL (e.g., http://pi-nas.local:3000)", false},
+	{"github", "GitHub", "", false},
+	{"gitlab", "GitLab", "GitLab URL (press Enter to skip, default: https://gitlab.com)", true},
+}
+
 var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Initialize gitea-sync configuration",
+	Long: `Initialize gitea-sync configuration.
+
+Prompts for the Gitea, GitHub and GitLab credentials of one profile and
+writes them to the config file, $XDG_CONFIG_HOME/gitea-sync/config.yaml
+unless --config names another one. The profile is the one selected with
+--profile or GITEA_SYNC_PROFILE, or else the default profile. Other
+profiles in the file are left as they are. With --edit, the prompts offer
+the current settings of the profile; press Enter to keep them.
+
+Tokens are kept in the config file, in the Secret Service keyring (the
+default when one is running), or read from a command such as
+'pass show gitea' or from a file. Tokens typed on a terminal are not
+echoed.
+
+Without prompts, e.g. in provisioning scripts, give the settings with the
+global setting flags (--gitea-url, --gitea-username, ...), a token on stdin
+with --gitea-token-stdin, --github-token-stdin or --gitlab-token-stdin, or
+all settings as a JSON object on stdin with --json-stdin. Settings that are
+not given keep their current value.
+
+Before saving, init signs in to every configured forge and checks that the
+token belongs to the username. Nothing is saved if a check fails, unless
+--no-verify is given. With --dry-run, the settings are checked and printed,
+tokens redacted, but neither the config file nor the keyring is written.
+
+Examples:
+  gitea-sync init                           # Set up the default profile
+  gitea-sync init --profile work            # Add or edit the work profile
+  gitea-sync init --profile work --default  # ... and use it by default
+  gitea-sync init --edit                    # Change some settings
+
+  # Provisioning
+  echo "$TOKEN" | gitea-sync init --gitea-url https://git.example.com \
+      --gitea-username bot --gitea-token-stdin
+  echo '{"gitea": {"url": "https://git.example.com", "username": "bot",
+      "token_file": "/run/secrets/gitea"}}' | gitea-sync init --json-stdin`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		reader := bufio.NewReader(os.Stdin)
-
-		fmt.Println("================================================")
-		fmt.Println("Gitea-Sync Configuration Setup")
-		fmt.Println("================================================\n")
-
-		// Get Gitea details
-		fmt.Print("Gitea URL (e.g., http://pi-nas.local:3000): ")
-		giteaURL, _ := reader.ReadString('\n')
-		giteaURL = strings.TrimSpace(giteaURL)
-
-		fmt.Print("Gitea Username: ")
-		giteaUsername, _ := reader.ReadString('\n')
-		giteaUsername = strings.TrimSpace(giteaUsername)
-
-		fmt.Print("Gitea Token: ")
-		giteaToken, _ := reader.ReadString('\n')
-		giteaToken = strings.TrimSpace(giteaToken)
-
-		// Get GitHub details
-		fmt.Print("\nGitHub Username: ")
-		githubUsername, _ := reader.ReadString('\n')
-		githubUsername = strings.TrimSpace(githubUsername)
-
-		fmt.Print("GitHub Token: ")
-		githubToken, _ := reader.ReadString('\n')
-		githubToken = strings.TrimSpace(githubToken)
-
-		// Get GitLab details (optional)
-		fmt.Print("\nGitLab URL (press Enter to skip, default: https://gitlab.com): ")
-		gitlabURL, _ := reader.ReadString('\n')
-		gitlabURL = strings.TrimSpace(gitlabURL)
-
-		var gitlabUsername, gitlabToken string
-		if gitlabURL != "" {
-			fmt.Print("GitLab Username: ")
-			gitlabUsername, _ = reader.ReadString('\n')
-			gitlabUsername = strings.TrimSpace(gitlabUsername)
-
-			fmt.Print("GitLab Token: ")
-			gitlabToken, _ = reader.ReadString('\n')
-			gitlabToken = strings.TrimSpace(gitlabToken)
-		}
-
-		// Create config
-		cfg := &config.Config{
-			Gitea: config.GiteaConfig{
-				URL:      giteaURL,
-				Token:    giteaToken,
-				Username: giteaUsername,
-			},
-			GitHub: config.GitHubConfig{
-				Token:    githubToken,
-				Username: githubUsername,
-			},
-			GitLab: config.GitLabConfig{
-				URL:      gitlabURL,
-				Token:    gitlabToken,
-				Username: gitlabUsername,
-			},
+		if !slices.Contains(tokenStorages, initStorage) {
+			return fmt.Errorf("invalid --token-storage %q (valid: %s)", initStorage, strings.Join(tokenStorages, ", "))
+		}
+		given, err := givenSettings()
+		if err != nil {
+			return err
+		}
+		interactive := len(given) == 0
+
+		// Start from the current settings of the profile, so that settings
+		// init does not ask for are kept
+		cfg := &config.Config{}
+		name := selectedProfile()
+		f, err := config.ReadFile()
+		switch {
+		case err == nil:
+			if current, err := f.Profile(name); err == nil {
+				cfg = current
+			}
+			if name == "" {
+				name = f.Default
+			}
+		case !errors.Is(err, fs.ErrNotExist):
+			return err
+		}
+		if name == "" {
+			name = config.DefaultProfile
+		}
+
+		setup := &initSetup{
+			reader:        bufio.NewReader(os.Stdin),
+			prompt:        promptOut(),
+			hidden:        isTerminal(os.Stdin),
+			cfg:           cfg,
+			profile:       name,
+			storage:       initStorage,
+			prefill:       initEdit,
+			keyringTokens: make(map[string]keyringToken),
+		}
+
+		fmt.Fprintln(out, "================================================")
+		fmt.Fprintln(out, "Gitea-Sync Configuration Setup")
+		fmt.Fprintf(out, "Profile: %s\n", name)
+		fmt.Fprintln(out, "================================================")
+
+		if interactive {
+			if err := setup.askStorage(cmd.Flags().Changed("token-storage")); err != nil {
+				return err
+			}
+		} else if err := setup.apply(given); err != nil {
+			return err
+		}
+
+		for _, section := range initSections {
+			for {
+				if interactive {
+					fmt.Fprintln(setup.prompt)
+					if err := setup.askSection(section); err != nil {
+						return err
+					}
+				}
+				if initNoVerify || !setup.configured(section.name) {
+					break
+				}
+				summary, err := setup.verify(cmd.Context(), section)
+				if err == nil {
+					fmt.Fprintf(out, "  ✓ %s\n", summary)
+					break
+				}
+				fmt.Fprintf(out, "  ✗ %s: %v\n", section.platform, err)
+				if !interactive || cmd.Context().Err() != nil {
+					return fmt.Errorf("%s check failed, nothing saved (use --no-verify to save anyway): %w", section.platform, err)
+				}
+				// Ask again, offering the answers just given
+				setup.prefill = true
+			}
+		}
+
+		// Store the tokens in the keyring before the config refers to them
+		for _, section := range initSections {
+			entry, ok := setup.keyringTokens[section.name]
+			if !ok {
+				continue
+			}
+			if dryRun {
+				fmt.Fprintf(out, "  [dry-run] store the %s token in the keyring as %s\n", entry.platform, entry.account)
+				continue
+			}
+			if err := keyring.Set(entry.account, entry.label, entry.token); err != nil {
+				return fmt.Errorf("failed to store the %s token in the keyring: %w", entry.platform, err)
+			}
+		}
+		if len(setup.keyringTokens) > 0 && !dryRun {
+			fmt.Fprintln(out, "\n✓ Tokens stored in the keyring")
 		}
 
 		// Save config
-		if err := config.Save(cfg); err != nil {
+		path, _ := config.ConfigPath()
+		if dryRun {
+			printDryRunProfile(path, name, cfg)
+		} else if err := config.SaveProfile(name, cfg, initDefault); err != nil {
 			return fmt.Errorf("failed to save config: %w", err)
 		}
 
-		path, _ := config.ConfigPath()
-		fmt.Println("\n================================================")
-		fmt.Println("✓ Configuration saved!")
-		fmt.Printf("Config file: %s\n", path)
-		fmt.Println("================================================")
-		fmt.Println("\nYou can now use:")
-		fmt.Println("  gitea-sync create <repo-name>    # Create new repo")
-		fmt.Println("  gitea-sync mirror <repo-name>    # Add mirror to existing repo")
-		fmt.Println("  gitea-sync bulk                  # Bulk setup repos")
-		fmt.Println("================================================")
+		fmt.Fprintln(out, "\n================================================")
+		if dryRun {
+			fmt.Fprintln(out, "✓ Configuration checked, nothing saved (dry run)")
+		} else {
+			fmt.Fprintln(out, "✓ Configuration saved!")
+		}
+		fmt.Fprintf(out, "Config file: %s\n", path)
+		fmt.Fprintf(out, "Profile: %s\n", name)
+		fmt.Fprintln(out, "================================================")
+		fmt.Fprintln(out, "\nYou can now use:")
+		fmt.Fprintln(out, "  gitea-sync create <repo-name>    # Create new repo")
+		fmt.Fprintln(out, "  gitea-sync mirror <repo-name>    # Add mirror to existing repo")
+		fmt.Fprintln(out, "  gitea-sync bulk                  # Bulk setup repos")
+		fmt.Fprintln(out, "================================================")
 
+		if jsonOutput() {
+			return printJSON(struct {
+				Config   string `json:"config"`
+				Profile  string `json:"profile"`
+				Verified bool   `json:"verified"`
+			}{path, name, !initNoVerify})
+		}
 		return nil
 	},
 }
 
+// printDryRunProfile prints the settings init would save as the profile
+// name into the config file at path, tokens redacted.
+func printDryRunProfile(path, name string, cfg *config.Config) {
+	fmt.Fprintf(out, "  [dry-run] save profile %s to %s:\n", name, path)
+	for _, key := range config.Keys() {
+		value := cfg.Get(key)
+		if value == "" {
+			continue
+		}
+		if config.IsSecret(key) {
+			value = redacted
+		}
+		fmt.Fprintf(out, "    %s: %s\n", key, value)
+	}
+	if initDefault {
+		fmt.Fprintf(out, "    default_profile: %s\n", name)
+	}
+}
+
+// givenSettings returns the settings given on the command line by key: as
+// JSON on stdin with --json-stdin, as a token on stdin with
+// --<section>-token-stdin, or with the global setting flags, which win.
+func givenSettings() (map[string]string, error) {
+	var stdinFlags []string
+	if initJSON {
+		stdinFlags = append(stdinFlags, "--json-stdin")
+	}
+	for _, section := range initSections {
+		if *initTokenStdin[section.name] {
+			stdinFlags = append(stdinFlags, "--"+section.name+"-token-stdin")
+		}
+	}
+	if len(stdinFlags) > 1 {
+		return nil, fmt.Errorf("only one of %s can read stdin", strings.Join(stdinFlags, ", "))
+	}
+
+	given := make(map[string]string)
+	if len(stdinFlags) == 1 {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read stdin: %w", err)
+		}
+		if initJSON {
+			settings, err := config.ParseSettings(data)
+			if err != nil {
+				return nil, fmt.Errorf("--json-stdin: %w", err)
+			}
+			for _, key := range config.Keys() {
+				if value := settings.Get(key); value != "" {
+					given[key] = value
+				}
+			}
+		} else {
+			token := strings.TrimSpace(string(data))
+			if token == "" {
+				return nil, fmt.Errorf("%s: no token on stdin", stdinFlags[0])
+			}
+			section := strings.TrimSuffix(strings.TrimPrefix(stdinFlags[0], "--"), "-token-stdin")
+			given[section+".token"] = token
+		}
+	}
+
+	flags := rootCmd.PersistentFlags()
+	for key, value := range settingFlags {
+		if flags.Changed(settingFlagName(key)) {
+			given[key] = *value
+		}
+	}
+	return given, nil
+}
+
+// initSetup is the state of an init run.
+type initSetup struct {
+	reader *bufio.Reader
+	prompt io.Writer
+	// hidden reports whether stdin is a terminal, so that tokens are read
+	// without echo.
+	hidden  bool
+	cfg     *config.Config
+	profile string
+	storage string
+	// prefill offers the current settings as answers to the prompts.
+	prefill bool
+	// keyringTokens maps sections to the tokens to store in the keyring
+	// when the config is saved.
+	keyringTokens map[string]keyringToken
+}
+
+// apply sets the given settings. A given token source replaces the other
+// token sources of its section. With the keyring storage, given tokens are
+// moved to the keyring.
+func (s *initSetup) apply(given map[string]string) error {
+	for _, key := range config.Keys() {
+		value, ok := given[key]
+		if !ok {
+			continue
+		}
+		section, field, _ := strings.Cut(key, ".")
+		if !slices.Contains(config.TokenKeys, field) {
+			if err := s.cfg.Set(key, value); err != nil {
+				return err
+			}
+			continue
+		}
+		if field == "token" && s.storage == storeKeyring {
+			s.storeInKeyring(section, value)
+			continue
+		}
+		setToken(s.cfg, section, field, value)
+	}
+
+	if s.cfg.Gitea.URL == "" || s.cfg.Gitea.Username == "" || !s.cfg.Gitea.IsSet() {
+		return fmt.Errorf("gitea.url, gitea.username and a Gitea token are required, e.g. --gitea-url, --gitea-username and --gitea-token-stdin")
+	}
+	return nil
+}
+
+// askStorage asks where to keep the tokens unless --token-storage was
+// given. The keyring is preferred over plain text in the config file.
+func (s *initSetup) askStorage(given bool) error {
+	if given {
+		return nil
+	}
+	def := storeConfig
+	if keyring.Available() {
+		def = storeKeyring
+	}
+	if s.prefill {
+		// Keep the storage of the current Gitea token
+		for storage, key := range storageKeys {
+			if s.cfg.Get("gitea."+key) != "" {
+				def = storage
+			}
+		}
+	}
+
+	fmt.Fprintln(s.prompt)
+	for {
+		storage, err := s.ask(fmt.Sprintf("Store tokens in (%s)", strings.Join(tokenStorages, ", ")), def, true)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(tokenStorages, storage) {
+			s.storage = storage
+			return nil
+		}
+		fmt.Fprintf(s.prompt, "  Choose one of %s\n", strings.Join(tokenStorages, ", "))
+	}
+}
+
+// askSection prompts for the URL, username and token of a forge. An
+// optional section whose URL is left empty is removed from the config.
+func (s *initSetup) askSection(section initSection) error {
+	if section.urlPrompt != "" {
+		def := s.current(section.name + ".url")
+		if def == "" && s.prefill && section.optional && s.configured(section.name) {
+			def = "https://gitlab.com"
+		}
+		url, err := s.ask(section.urlPrompt, def, !section.optional)
+		if err != nil {
+			return err
+		}
+		if url == "" {
+			for _, key := range config.Keys() {
+				if strings.HasPrefix(key, section.name+".") {
+					s.cfg.Set(key, "")
+				}
+			}
+			delete(s.keyringTokens, section.name)
+			return nil
+		}
+		s.cfg.Set(section.name+".url", url)
+	}
+
+	required := !section.optional && section.name == "gitea"
+	username, err := s.ask(section.platform+" Username", s.current(section.name+".username"), required)
+	if err != nil {
+		return err
+	}
+	s.cfg.Set(section.name+".username", username)
+
+	return s.askToken(section, required)
+}
+
+// askToken asks for the token of a forge, or for the command or file
+// providing it, depending on the storage. With prefill, an empty answer
+// keeps the current token.
+func (s *initSetup) askToken(section initSection, required bool) error {
+	key := storageKeys[s.storage]
+	current := s.current(section.name + "." + key)
+	for {
+		var answer string
+		var err error
+		switch s.storage {
+		case storeCommand:
+			answer, err = s.ask(fmt.Sprintf("%s token command (e.g. pass show %s)", section.platform, section.name), current, false)
+		case storeFile:
+			answer, err = s.ask(section.platform+" token file", current, false)
+		default:
+			question := section.platform + " Token"
+			if current != "" {
+				question += " [keep current]"
+			}
+			answer, err = s.askSecret(question)
+			if answer == "" && current != "" {
+				return nil
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if answer == "" && required {
+			fmt.Fprintln(s.prompt, "  A value is required")
+			continue
+		}
+
+		if s.storage == storeKeyring && answer != "" {
+			s.storeInKeyring(section.name, answer)
+			return nil
+		}
+		delete(s.keyringTokens, section.name)
+		setToken(s.cfg, section.name, key, answer)
+		return nil
+	}
+}
+
+// storeInKeyring points the config at the keyring account of the token of
+// section, and remembers the token to store when the config is saved.
+func (s *initSetup) storeInKeyring(section, token string) {
+	platform := section
+	for _, sec := range initSections {
+		if sec.name == section {
+			platform = sec.platform
+		}
+	}
+	account := config.KeyringAccount(s.profile, section)
+	s.keyringTokens[section] = keyringToken{
+		platform: platform,
+		account:  account,
+		label:    fmt.Sprintf("gitea-sync %s token (profile %s)", platform, s.profile),
+		token:    token,
+	}
+	setToken(s.cfg, section, "token_keyring", account)
+}
+
+// current returns the setting key to offer as the answer to its prompt,
+// or "" without prefill.
+func (s *initSetup) current(key string) string {
+	if !s.prefill {
+		return ""
+	}
+	return s.cfg.Get(key)
+}
+
+// ask prints question and reads the answer. An empty answer selects def,
+// which is shown in brackets. A required question is asked again until it
+// is answered.
+func (s *initSetup) ask(question, def string, required bool) (string, error) {
+	for {
+		if def != "" {
+			fmt.Fprintf(s.prompt, "%s [%s]: ", question, def)
+		} else {
+			fmt.Fprintf(s.prompt, "%s: ", question)
+		}
+		answer, err := s.reader.ReadString('\n')
+		answer = strings.TrimSpace(answer)
+		if err != nil && answer == "" {
+			return "", promptError(question, err)
+		}
+		if answer == "" {
+			answer = def
+		}
+		if answer != "" || !required {
+			return answer, nil
+		}
+		fmt.Fprintln(s.prompt, "  A value is required")
+	}
+}
+
+// askSecret reads a token, without echoing it if stdin is a terminal.
+func (s *initSetup) askSecret(question string) (string, error) {
+	if !s.hidden {
+		return s.ask(question, "", false)
+	}
+	fmt.Fprintf(s.prompt, "%s: ", question)
+	answer, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(s.prompt)
+	if err != nil {
+		return "", promptError(question, err)
+	}
+	return strings.TrimSpace(string(answer)), nil
+}
+
+// promptError describes a failed read of the answer to question.
+func promptError(question string, err error) error {
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("no answer to %q: end of input", question)
+	}
+	return fmt.Errorf("failed to read the answer to %q: %w", question, err)
+}
+
+// configured reports whether a username or token is set for section.
+func (s *initSetup) configured(section string) bool {
+	return s.cfg.Get(section+".username") != "" || hasTokenSource(s.cfg, section)
+}
+
+// verify signs in to the forge of section and checks that the token
+// belongs to the configured username. It returns a summary of the account.
+func (s *initSetup) verify(ctx context.Context, section initSection) (string, error) {
+	// Check a copy that holds the tokens not yet stored in the keyring
+	cfg := *s.cfg
+	if entry, ok := s.keyringTokens[section.name]; ok {
+		setToken(&cfg, section.name, "token", entry.token)
+	}
+	username := cfg.Get(section.name + ".username")
+
+	if section.name == "gitea" {
+		giteaClient, err := newGiteaClient(&cfg)
+		if err != nil {
+			return "", err
+		}
+		version, err := giteaClient.Version(ctx)
+		if err != nil {
+			return "", fmt.Errorf("cannot reach %s: %w", cfg.Gitea.URL, err)
+		}
+		user, err := giteaClient.CurrentUser(ctx)
+		if err != nil {
+			return "", fmt.Errorf("token rejected: %w", err)
+		}
+		if err := checkLogin(user.Login, username, "gitea.username"); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Signed in to Gitea %s as %s", version, user.Login), nil
+	}
+
+	httpClient, err := newHTTPClient(&cfg, nil)
+	if err != nil {
+		return "", err
+	}
+	target, err := forge.New(section.name, &cfg, httpClient)
+	if err != nil {
+		return "", err
+	}
+	verifier, ok := target.(forge.Verifier)
+	if !ok {
+		return fmt.Sprintf("%s tokens cannot be checked", target.DisplayName()), nil
+	}
+	account, err := verifier.Account(ctx)
+	if _, ok := apierror.As(err); ok {
+		return "", fmt.Errorf("token rejected: %w", err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot reach %s: %w", target.DisplayName(), err)
+	}
+	if err := checkLogin(account.Username, username, section.name+".username"); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Signed in to %s as %s", target.DisplayName(), account.Username), nil
+}
+
+// checkLogin checks that the token authenticates as the configured
+// username. Forges compare usernames case-insensitively.
+func checkLogin(actual, configured, key string) error {
+	if !strings.EqualFold(actual, configured) {
+		return fmt.Errorf("the token belongs to %s, but %s is %q", actual, key, configured)
+	}
+	return nil
+}
+
+// setToken sets the token source field of section to value and clears the
+// other token sources of the section.
+func setToken(cfg *config.Config, section, field, value string) {
+	for _, key := range config.TokenKeys {
+		cfg.Set(section+"."+key, "")
+	}
+	cfg.Set(section+"."+field, value)
+}
+
 func init() {
+	initCmd.Flags().BoolVar(&initDefault, "default", false, "Make the profile the default profile")
+	initCmd.Flags().BoolVar(&initEdit, "edit", false, "Offer the current settings of the profile in the prompts")
+	initCmd.Flags().BoolVar(&initNoVerify, "no-verify", false, "Save the settings without signing in to the forges")
+	initCmd.Flags().BoolVar(&initJSON, "json-stdin", false, "Read the settings as a JSON object from stdin instead of prompting")
+	initCmd.Flags().StringVar(&initStorage, "token-storage", storeConfig,
+		fmt.Sprintf("Where to keep tokens: %s (asked when prompting)", strings.Join(tokenStorages, ", ")))
+	for _, section := range initSections {
+		initTokenStdin[section.name] = initCmd.Flags().Bool(section.name+"-token-stdin", false,
+			fmt.Sprintf("Read the %s token from stdin instead of prompting", section.platform))
+	}
 	rootCmd.AddCommand(initCmd)
 }
@@ -3,70 +3,107 @@ package cmd
 import (
 	"fmt"
 
-	"github.com/Papiermond/gitea-sync/internal/config"
-	"github.com/Papiermond/gitea-sync/internal/gitea"
 	"github.com/spf13/cobra"
 )
 
+var (
+	mirrorTargets []string
+	mirrorSync    bool
+	mirrorOwner   string
+)
+
 var mirrorCmd = &cobra.Command{
 	Use:   "mirror <repo-name>",
-	Short: "Add GitHub push mirror to an existing Gitea repository",
+	Short: "Add a push mirror to an existing Gitea repository",
 	Args:  cobra.ExactArgs(1),
-	RunE: func(cmd *cobra.Command, args []string) error {
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
 		repoName := args[0]
 
+		// Print the JSON result once the command returns
+		result := &repoResult{Repo: repoName}
+		var results []*targetResult
+		defer func() {
+			result.setTargets(results, repoName, defaultMirrorOptions)
+			result.emit(err)
+		}()
+
 		// Load config
-		cfg, err := config.Load()
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		// Read the mirror targets of the project in the current directory
+		project, err := findProject(".")
+		if err != nil {
+			return err
+		}
+		project.Apply(cfg)
+		applyOwnerFlag(cmd, cfg, mirrorOwner)
+
+		// Resolve the mirror targets
+		targets, err := resolveTargets(cfg, mirrorTargets, false, false)
 		if err != nil {
 			return err
 		}
 
 		// Initialize client
-		giteaClient := gitea.NewClient(cfg.Gitea.URL, cfg.Gitea.Token)
+		giteaClient, err := newGiteaClient(cfg)
+		if err != nil {
+			return err
+		}
 
-		fmt.Println("================================================")
-		fmt.Printf("Setting up mirror for: %s\n", repoName)
-		fmt.Println("================================================")
+		fmt.Fprintln(out, "================================================")
+		fmt.Fprintf(out, "Setting up mirror for: %s/%s\n", cfg.Gitea.RepoOwner(), repoName)
+		fmt.Fprintln(out, "================================================")
 
 		// Check if repo exists
-		fmt.Println("\nChecking Gitea repository...")
-		exists, err := giteaClient.RepoExists(cfg.Gitea.Username, repoName)
+		fmt.Fprintln(out, "\nChecking Gitea repository...")
+		exists, err := giteaClient.RepoExists(cmd.Context(), cfg.Gitea.RepoOwner(), repoName)
 		if err != nil {
-			return fmt.Errorf("failed to check Gitea: %w", err)
+			return fmt.Errorf("failed to check Gitea: %w", withHint(err))
 		}
 
 		if !exists {
 			return fmt.Errorf("repository does not exist on Gitea")
 		}
-		fmt.Println("  ✓ Repository found")
-
-		// Set up push mirror
-		fmt.Println("\nSetting up GitHub mirror...")
-		err = giteaClient.AddPushMirror(cfg.Gitea.Username, repoName, gitea.PushMirrorRequest{
-			RemoteAddress:  fmt.Sprintf("https://github.com/%s/%s.git", cfg.GitHub.Username, repoName),
-			RemotePassword: cfg.GitHub.Token,
-			RemoteUsername: cfg.GitHub.Username,
-			SyncOnCommit:   true,
-			Interval:       "8h",
-		})
-		if err != nil {
-			return fmt.Errorf("failed to set up mirror: %w", err)
+		fmt.Fprintln(out, "  ✓ Repository found")
+		result.URL = giteaWebURL(cfg, repoName)
+		result.Gitea = stateExisted
+
+		// Set up push mirrors
+		fmt.Fprintf(out, "\nSetting up push mirrors (%s)...\n", targetNames(targets))
+		results = newTargetResults(targets)
+		addPushMirrors(cmd.Context(), out, giteaClient, cfg.Gitea.RepoOwner(), repoName, defaultMirrorOptions, results)
+		if len(succeededTargets(results)) == 0 {
+			return targetsError(results)
+		}
+
+		// Trigger an initial sync
+		if mirrorSync {
+			fmt.Fprintln(out, "\nSyncing push mirrors...")
+			if err := giteaClient.SyncPushMirrors(cmd.Context(), cfg.Gitea.RepoOwner(), repoName); err != nil {
+				return fmt.Errorf("failed to sync mirrors: %w", err)
+			}
+			fmt.Fprintln(out, "  ✓ Sync started")
 		}
-		fmt.Println("  ✓ Mirror configured")
-
-		fmt.Println("\n================================================")
-		fmt.Println("✓ Mirror setup complete!")
-		fmt.Println("================================================")
-		fmt.Printf("\nRepository URLs:\n")
-		fmt.Printf("  Gitea:  %s/%s/%s\n", cfg.Gitea.URL, cfg.Gitea.Username, repoName)
-		fmt.Printf("  GitHub: https://github.com/%s/%s\n", cfg.GitHub.Username, repoName)
-		fmt.Println("\nThe repository will sync on every commit and every 8 hours.")
-		fmt.Println("================================================")
-
-		return nil
+
+		fmt.Fprintln(out, "\n================================================")
+		fmt.Fprintln(out, "✓ Mirror setup complete!")
+		fmt.Fprintln(out, "================================================")
+		fmt.Fprintf(out, "\nRepository URLs:\n")
+		fmt.Fprintf(out, "  Gitea:  %s\n", giteaWebURL(cfg, repoName))
+		printTargetURLs(results, repoName)
+		fmt.Fprintln(out, "\nThe repository will sync on every commit and every 8 hours.")
+		fmt.Fprintln(out, "================================================")
+
+		return targetsError(results)
 	},
 }
 
 func init() {
+	addTargetFlag(mirrorCmd, &mirrorTargets)
+	addOwnerFlag(mirrorCmd, &mirrorOwner)
+	mirrorCmd.Flags().BoolVar(&mirrorSync, "sync", false, "Sync the push mirrors right after setting them up")
 	rootCmd.AddCommand(mirrorCmd)
 }
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Papiermond/gitea-sync/internal/apierror"
+)
+
+// Output formats of --output.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// Resource states reported in results.
+const (
+	stateCreated   = "created"
+	stateExisted   = "existed"
+	stateAdded     = "added"
+	stateReplaced  = "replaced"
+	stateUnchanged = "unchanged"
+)
+
+var (
+	outputFormat string
+	quiet        bool
+
+	// out receives the progress output meant for people: banners, steps
+	// and ✓/✗ lines. It is stdout for text output, stderr for JSON output
+	// and discarded with --quiet.
+	out io.Writer = os.Stdout
+
+	// resultPrinted is set once a command has printed its JSON result, so
+	// that Execute does not print another one for the returned error.
+	resultPrinted bool
+)
+
+// setupOutput validates --output and points out at the right stream.
+func setupOutput() error {
+	switch outputFormat {
+	case outputText, outputJSON:
+	default:
+		return fmt.Errorf("--output must be %s or %s, got %q", outputText, outputJSON, outputFormat)
+	}
+
+	switch {
+	case quiet:
+		out = io.Discard
+	case outputFormat == outputJSON:
+		out = os.Stderr
+	}
+	return nil
+}
+
+// promptOut returns the writer for interactive prompts, which are shown
+// even with --quiet.
+func promptOut() io.Writer {
+	if quiet {
+		return os.Stderr
+	}
+	return out
+}
+
+// jsonOutput reports whether results are printed as JSON.
+func jsonOutput() bool {
+	return outputFormat == outputJSON
+}
+
+// printJSON prints v to stdout as one line of JSON.
+func printJSON(v any) error {
+	resultPrinted = true
+	return json.NewEncoder(os.Stdout).Encode(v)
+}
+
+// errorResult is an error in a JSON result. Platform and Status are set
+// for failed API calls.
+type errorResult struct {
+	Message  string `json:"message"`
+	Platform string `json:"platform,omitempty"`
+	Status   int    `json:"status,omitempty"`
+}
+
+// newErrorResult returns the JSON form of err, or nil for a nil error.
+func newErrorResult(err error) *errorResult {
+	if err == nil {
+		return nil
+	}
+	result := &errorResult{Message: err.Error()}
+	if apiErr, ok := apierror.As(err); ok {
+		result.Platform = apiErr.Platform
+		result.Status = apiErr.StatusCode
+	}
+	return result
+}
+
+// withHint adds what to do about an authentication or rate limit error
+// to err.
+func withHint(err error) error {
+	apiErr, ok := apierror.As(err)
+	switch {
+	case !ok:
+		return err
+	case apierror.IsAuth(err):
+		return fmt.Errorf("%w (check the %s token and its permissions)", err, apiErr.Platform)
+	case apierror.IsRateLimited(err):
+		return fmt.Errorf("%w (%s rate limit exceeded, try again later)", err, apiErr.Platform)
+	}
+	return err
+}
+
+// repoResult is the JSON result of setting up one repository.
+type repoResult struct {
+	Repo string `json:"repo"`
+	// Path is the local repository of add and create.
+	Path string `json:"path,omitempty"`
+	// URL is the browser URL of the Gitea repository.
+	URL string `json:"url,omitempty"`
+	// Gitea is stateCreated or stateExisted once the Gitea repository is
+	// in place.
+	Gitea string `json:"gitea,omitempty"`
+	// Source is the clone URL an imported repository is pulled from.
+	Source  string             `json:"source,omitempty"`
+	Targets []targetRepoResult `json:"targets,omitempty"`
+	Error   *errorResult       `json:"error,omitempty"`
+}
+
+// targetRepoResult is the JSON result of one mirror target of a repository.
+type targetRepoResult struct {
+	Target string `json:"target"`
+	URL    string `json:"url"`
+	// Repo is stateCreated or stateExisted if the repository on the target
+	// was checked.
+	Repo string `json:"repo,omitempty"`
+	// Mirror is stateAdded, stateReplaced or stateUnchanged once the push
+	// mirror is set up.
+	Mirror string       `json:"mirror,omitempty"`
+	Error  *errorResult `json:"error,omitempty"`
+}
+
+// setTargets records the target results of repoName in r.
+func (r *repoResult) setTargets(results []*targetResult, repoName string, opts mirrorOptions) {
+	if opts.TargetRepo != "" {
+		repoName = opts.TargetRepo
+	}
+	r.Targets = make([]targetRepoResult, 0, len(results))
+	for _, result := range results {
+		r.Targets = append(r.Targets, targetRepoResult{
+			Target: result.target.Name(),
+			URL:    targetWebURL(result.target, repoName),
+			Repo:   result.repo,
+			Mirror: result.mirror,
+			Error:  newErrorResult(result.err),
+		})
+	}
+}
+
+// emit prints r with err as its error when the output is JSON.
+func (r *repoResult) emit(err error) {
+	if !jsonOutput() {
+		return
+	}
+	r.Error = newErrorResult(err)
+	printJSON(r)
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Papiermond/gitea-sync/internal/apierror"
+	"github.com/Papiermond/gitea-sync/internal/config"
+	"github.com/Papiermond/gitea-sync/internal/gitea"
+	"github.com/spf13/cobra"
+)
+
+// addOwnerFlag registers --owner and its alias --org on cmd.
+func addOwnerFlag(cmd *cobra.Command, owner *string) {
+	cmd.Flags().StringVar(owner, "owner", "", "Gitea organization owning the repository (default gitea.owner, else gitea.username)")
+	cmd.Flags().StringVar(owner, "org", "", "Same as --owner")
+	// Both set the same variable, so the later flag would silently win
+	cmd.MarkFlagsMutuallyExclusive("owner", "org")
+}
+
+// applyOwnerFlag overrides gitea.owner with the --owner or --org flag of
+// cmd, if given.
+func applyOwnerFlag(cmd *cobra.Command, cfg *config.Config, owner string) {
+	for _, name := range []string{"owner", "org"} {
+		if cmd.Flags().Changed(name) {
+			cfg.Gitea.Owner = owner
+			cfg.Sources["gitea.owner"] = config.SourceFlag + " --" + name
+		}
+	}
+}
+
+// checkGiteaOwner checks that the Gitea user may create repositories in
+// the configured organization. Nothing needs checking for the user's own
+// repositories.
+func checkGiteaOwner(ctx context.Context, giteaClient *gitea.Client, cfg *config.Config) error {
+	if !cfg.Gitea.IsOrgOwner() {
+		return nil
+	}
+	owner, username := cfg.Gitea.Owner, cfg.Gitea.Username
+	permissions, err := giteaClient.OrgPermissions(ctx, username, owner)
+	if apierror.IsNotFound(err) {
+		return fmt.Errorf("gitea.owner: no Gitea organization %q that %s is a member of", owner, username)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check the Gitea organization %s: %w", owner, withHint(err))
+	}
+	if !permissions.CanCreateRepository {
+		return fmt.Errorf("gitea.owner: %s may not create repositories in the Gitea organization %s", username, owner)
+	}
+	return nil
+}
+
+// createGiteaRepo creates a repository owned by the configured owner, see
+// config.GiteaConfig.RepoOwner.
+func createGiteaRepo(ctx context.Context, giteaClient *gitea.Client, cfg *config.Config, req gitea.CreateRepoRequest) error {
+	if cfg.Gitea.IsOrgOwner() {
+		return giteaClient.CreateOrgRepo(ctx, cfg.Gitea.Owner, req)
+	}
+	return giteaClient.CreateRepo(ctx, req)
+}
@@ -0,0 +1,391 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Papiermond/gitea-sync/internal/config"
+	"github.com/Papiermond/gitea-sync/internal/forge"
+	"github.com/Papiermond/gitea-sync/internal/gitea"
+	"github.com/Papiermond/gitea-sync/internal/manifest"
+	"github.com/spf13/cobra"
+)
+
+var planFile string
+
+// change is one difference between the manifest and the actual state,
+// together with the call that resolves it.
+type change struct {
+	repo    string
+	action  string // "create", "add", "update" or "replace"
+	summary string
+	apply   func(ctx context.Context) error
+}
+
+// planResult is the JSON result of plan and apply.
+type planResult struct {
+	File    string         `json:"file"`
+	Changes []changeResult `json:"changes"`
+}
+
+// changeResult is the JSON form of a change. Status is "applied", "failed"
+// or "skipped" after apply.
+type changeResult struct {
+	Repo    string       `json:"repo"`
+	Action  string       `json:"action"`
+	Summary string       `json:"summary"`
+	Status  string       `json:"status,omitempty"`
+	Error   *errorResult `json:"error,omitempty"`
+}
+
+func (c change) result() changeResult {
+	return changeResult{Repo: c.repo, Action: c.action, Summary: c.summary}
+}
+
+func (c change) symbol() string {
+	if c.action == "create" || c.action == "add" {
+		return "+"
+	}
+	return "~"
+}
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Show the changes needed to match a repository manifest",
+	Long: `Show the changes needed to make Gitea and the mirror targets match a
+repository manifest. Nothing is modified; run 'gitea-sync apply' to make
+the changes.
+
+Example manifest (repos.yaml):
+
+  defaults:
+    visibility: public
+    targets: [github]
+    interval: 8h
+  repos:
+    - name: my-project
+      description: My project
+      topics: [go, cli]
+    - name: secret-project
+      visibility: private
+      targets: [github, gitlab]
+      interval: 1h
+
+Examples:
+  gitea-sync plan -f repos.yaml`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := manifest.Load(planFile)
+		if err != nil {
+			return err
+		}
+
+		// Load config
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		// Initialize client
+		giteaClient, err := newGiteaClient(cfg)
+		if err != nil {
+			return err
+		}
+
+		changes, err := planManifest(cmd.Context(), cfg, giteaClient, m)
+		if err != nil {
+			return err
+		}
+
+		printPlan(planFile, changes)
+		if jsonOutput() {
+			result := planResult{File: planFile, Changes: make([]changeResult, 0, len(changes))}
+			for _, c := range changes {
+				result.Changes = append(result.Changes, c.result())
+			}
+			return printJSON(result)
+		}
+		return nil
+	},
+}
+
+// planManifest compares every repository of the manifest with its actual
+// state on Gitea and the mirror targets.
+func planManifest(ctx context.Context, cfg *config.Config, giteaClient *gitea.Client, m *manifest.Manifest) ([]change, error) {
+	if err := checkGiteaOwner(ctx, giteaClient, cfg); err != nil {
+		return nil, err
+	}
+
+	var changes []change
+	for _, repo := range m.Repos {
+		repoChanges, err := planRepo(ctx, cfg, giteaClient, repo)
+		if err != nil {
+			return nil, fmt.Errorf("repo %s: %w", repo.Name, err)
+		}
+		changes = append(changes, repoChanges...)
+	}
+	return changes, nil
+}
+
+func planRepo(ctx context.Context, cfg *config.Config, giteaClient *gitea.Client, repo manifest.Repo) ([]change, error) {
+	owner := cfg.Gitea.RepoOwner()
+	targets, err := resolveTargets(cfg, repo.Targets, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	visibility := repo.Visibility
+	if visibility == "" {
+		visibility = "public"
+	}
+
+	var changes []change
+
+	// Mirror targets must exist before Gitea can push to them
+	for _, target := range targets {
+		targetOwner := target.Owner()
+		exists, err := target.RepoExists(ctx, targetOwner, repo.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check %s: %w", target.DisplayName(), withHint(err))
+		}
+		if exists {
+			targetChanges, err := planTargetRepo(ctx, target, repo)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, targetChanges...)
+			continue
+		}
+		changes = append(changes, change{
+			repo:    repo.Name,
+			action:  "create",
+			summary: fmt.Sprintf("%s repo %s (%s)", target.DisplayName(), target.WebURL(targetOwner, repo.Name), visibility),
+			apply: func(ctx context.Context) error {
+				return target.CreateRepo(ctx, forge.CreateRepoOptions{
+					Name:        repo.Name,
+					Description: repo.Description,
+					Private:     repo.Private(),
+				})
+			},
+		})
+	}
+
+	// Gitea repository
+	exists, err := giteaClient.RepoExists(ctx, owner, repo.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check Gitea: %w", withHint(err))
+	}
+
+	var mirrors []gitea.PushMirror
+	if !exists {
+		changes = append(changes, change{
+			repo:    repo.Name,
+			action:  "create",
+			summary: fmt.Sprintf("Gitea repo %s/%s (%s)", owner, repo.Name, visibility),
+			apply: func(ctx context.Context) error {
+				return createGiteaRepo(ctx, giteaClient, cfg, gitea.CreateRepoRequest{
+					Name:        repo.Name,
+					Description: repo.Description,
+					Private:     repo.Private(),
+					AutoInit:    false,
+				})
+			},
+		})
+		if len(repo.Topics) > 0 {
+			changes = append(changes, topicsChange(giteaClient, owner, repo, nil))
+		}
+	} else {
+		actual, err := giteaClient.GetRepo(ctx, owner, repo.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		diffs, private, description := diffRepo(repo, actual.Private, actual.Description)
+		edit := gitea.EditRepoRequest{Private: private, Description: description}
+		if len(diffs) > 0 {
+			changes = append(changes, change{
+				repo:    repo.Name,
+				action:  "update",
+				summary: fmt.Sprintf("Gitea repo %s/%s: %s", owner, repo.Name, strings.Join(diffs, ", ")),
+				apply: func(ctx context.Context) error {
+					return giteaClient.EditRepo(ctx, owner, repo.Name, edit)
+				},
+			})
+		}
+
+		if repo.Topics != nil {
+			topics, err := giteaClient.GetTopics(ctx, owner, repo.Name)
+			if err != nil {
+				return nil, err
+			}
+			if !sameTopics(topics, repo.Topics) {
+				changes = append(changes, topicsChange(giteaClient, owner, repo, topics))
+			}
+		}
+
+		mirrors, err = giteaClient.ListPushMirrors(ctx, owner, repo.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Push mirrors
+	opts := mirrorOptions{Interval: repo.Interval, SyncOnCommit: defaultMirrorOptions.SyncOnCommit}
+	for _, target := range targets {
+		req := pushMirrorRequest(target, repo.Name, opts)
+		existing, ok := gitea.FindPushMirror(mirrors, req.RemoteAddress)
+		switch {
+		case !ok:
+			changes = append(changes, change{
+				repo:    repo.Name,
+				action:  "add",
+				summary: fmt.Sprintf("%s push mirror %s (every %s)", target.DisplayName(), req.RemoteAddress, req.Interval),
+				apply: func(ctx context.Context) error {
+					return giteaClient.AddPushMirror(ctx, owner, repo.Name, req)
+				},
+			})
+		case !existing.Matches(req):
+			changes = append(changes, change{
+				repo:   repo.Name,
+				action: "replace",
+				summary: fmt.Sprintf("%s push mirror %s: interval %s → %s, sync on commit %t → %t",
+					target.DisplayName(), req.RemoteAddress, existing.Interval, req.Interval, existing.SyncOnCommit, req.SyncOnCommit),
+				// The new mirror is added first, so that a failure keeps the
+				// old one
+				apply: func(ctx context.Context) error {
+					if err := giteaClient.AddPushMirror(ctx, owner, repo.Name, req); err != nil {
+						return err
+					}
+					if err := giteaClient.DeletePushMirror(ctx, owner, repo.Name, existing.RemoteName); err != nil {
+						return fmt.Errorf("added the new mirror, but failed to delete the old mirror %s: %w", existing.RemoteName, err)
+					}
+					return nil
+				},
+			})
+		}
+	}
+
+	return changes, nil
+}
+
+// planTargetRepo compares the visibility and description of repo with the
+// existing repository on target, if the target can read and change them.
+func planTargetRepo(ctx context.Context, target forge.Provider, repo manifest.Repo) ([]change, error) {
+	editor, ok := target.(forge.Editor)
+	if !ok {
+		return nil, nil
+	}
+	owner := target.Owner()
+	actual, err := editor.GetRepo(ctx, owner, repo.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check %s: %w", target.DisplayName(), withHint(err))
+	}
+
+	diffs, private, description := diffRepo(repo, actual.Private, actual.Description)
+	if len(diffs) == 0 {
+		return nil, nil
+	}
+	return []change{{
+		repo:    repo.Name,
+		action:  "update",
+		summary: fmt.Sprintf("%s repo %s: %s", target.DisplayName(), target.WebURL(owner, repo.Name), strings.Join(diffs, ", ")),
+		apply: func(ctx context.Context) error {
+			return editor.EditRepo(ctx, owner, repo.Name, forge.EditRepoOptions{Private: private, Description: description})
+		},
+	}}, nil
+}
+
+// diffRepo compares the visibility and description of repo with the actual
+// ones. It returns the differences for display and the new values of the
+// settings that differ, nil for the others.
+func diffRepo(repo manifest.Repo, actualPrivate bool, actualDescription string) (diffs []string, private *bool, description *string) {
+	if repo.Visibility != "" && actualPrivate != repo.Private() {
+		wanted := repo.Private()
+		private = &wanted
+		diffs = append(diffs, fmt.Sprintf("visibility %s → %s", visibilityName(actualPrivate), repo.Visibility))
+	}
+	if repo.Description != "" && actualDescription != repo.Description {
+		wanted := repo.Description
+		description = &wanted
+		diffs = append(diffs, fmt.Sprintf("description %q → %q", actualDescription, repo.Description))
+	}
+	return diffs, private, description
+}
+
+func topicsChange(giteaClient *gitea.Client, owner string, repo manifest.Repo, current []string) change {
+	return change{
+		repo:    repo.Name,
+		action:  "update",
+		summary: fmt.Sprintf("Gitea topics of %s/%s: %v → %v", owner, repo.Name, current, repo.Topics),
+		apply: func(ctx context.Context) error {
+			return giteaClient.SetTopics(ctx, owner, repo.Name, repo.Topics)
+		},
+	}
+}
+
+// sameTopics compares topic lists ignoring order and case, as Gitea stores
+// topics in lower case.
+func sameTopics(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	normalize := func(topics []string) []string {
+		out := make([]string, len(topics))
+		for i, topic := range topics {
+			out[i] = strings.ToLower(topic)
+		}
+		sort.Strings(out)
+		return out
+	}
+	na, nb := normalize(a), normalize(b)
+	for i := range na {
+		if na[i] != nb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func visibilityName(private bool) string {
+	if private {
+		return "private"
+	}
+	return "public"
+}
+
+func printPlan(path string, changes []change) {
+	fmt.Fprintln(out, "================================================")
+	fmt.Fprintf(out, "Plan for: %s\n", path)
+	fmt.Fprintln(out, "================================================")
+
+	if len(changes) == 0 {
+		fmt.Fprintln(out, "\n✓ No changes. Gitea and the mirror targets match the manifest.")
+		return
+	}
+
+	added, changed := 0, 0
+	repo := ""
+	for _, c := range changes {
+		if c.repo != repo {
+			repo = c.repo
+			fmt.Fprintf(out, "\n%s\n", repo)
+		}
+		fmt.Fprintf(out, "  %s %s %s\n", c.symbol(), c.action, c.summary)
+		if c.symbol() == "+" {
+			added++
+		} else {
+			changed++
+		}
+	}
+
+	fmt.Fprintln(out, "\n================================================")
+	fmt.Fprintf(out, "Plan: %d to add, %d to change.\n", added, changed)
+	fmt.Fprintln(out, "================================================")
+}
+
+func init() {
+	planCmd.Flags().StringVarP(&planFile, "file", "f", "repos.yaml", "Path to the repository manifest")
+	rootCmd.AddCommand(planCmd)
+}
@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/Papiermond/gitea-sync/internal/apierror"
+	"github.com/Papiermond/gitea-sync/internal/forge"
+	"github.com/Papiermond/gitea-sync/internal/gitea"
+	"golang.org/x/term"
+)
+
+// rollback records the resources a run creates so that they can be deleted
+// again when a later step fails. Resources that existed before the run are
+// never recorded.
+type rollback struct {
+	steps []rollbackStep
+	// partial is set once the steps are limited to the failed targets of a
+	// run that worked for the others.
+	partial bool
+}
+
+type rollbackStep struct {
+	resource string
+	// target is the name of the mirror target the resource belongs to, or
+	// "" for Gitea and the local repository.
+	target string
+	undo   func(ctx context.Context) error
+}
+
+func (r *rollback) record(resource string, undo func(ctx context.Context) error) {
+	r.steps = append(r.steps, rollbackStep{resource: resource, undo: undo})
+}
+
+// recordTarget records a resource created for the mirror target.
+func (r *rollback) recordTarget(target forge.Provider, resource string, undo func(ctx context.Context) error) {
+	r.steps = append(r.steps, rollbackStep{resource: resource, target: target.Name(), undo: undo})
+}
+
+// retainFailed drops the steps of Gitea, the local repository and the
+// targets that succeeded. A run that failed for some targets only offers
+// to delete what it created for them, as the rest is in use.
+func (r *rollback) retainFailed(results []*targetResult) {
+	var failed []string
+	for _, result := range results {
+		if result.err != nil {
+			failed = append(failed, result.target.Name())
+		}
+	}
+	r.steps = slices.DeleteFunc(r.steps, func(step rollbackStep) bool {
+		return !slices.Contains(failed, step.target)
+	})
+	r.partial = true
+}
+
+// recordTargetRepos records the target repositories created for repoName.
+func (r *rollback) recordTargetRepos(results []*targetResult, repoName string) {
+	for _, result := range results {
+		if result.repo != stateCreated {
+			continue
+		}
+		target := result.target
+		owner := target.Owner()
+		r.recordTarget(target, fmt.Sprintf("%s repo %s", target.DisplayName(), target.WebURL(owner, repoName)), func(ctx context.Context) error {
+			return target.DeleteRepo(ctx, owner, repoName)
+		})
+	}
+}
+
+// recordPushMirrors records the push mirrors added to a Gitea repository
+// that existed before the run. Mirrors of a repository created by the run
+// are deleted together with it. opts must have KeepExisting set, as a
+// replaced mirror could not be restored.
+func (r *rollback) recordPushMirrors(giteaClient *gitea.Client, owner, repoName string, opts mirrorOptions, results []*targetResult) {
+	for _, result := range results {
+		if result.mirror != stateAdded {
+			continue
+		}
+		address := pushMirrorRequest(result.target, repoName, opts).RemoteAddress
+		r.recordTarget(result.target, fmt.Sprintf("Gitea push mirror of %s/%s to %s", owner, repoName, address), func(ctx context.Context) error {
+			mirrors, err := giteaClient.ListPushMirrors(ctx, owner, repoName)
+			if err != nil {
+				return err
+			}
+			mirror, ok := gitea.FindPushMirror(mirrors, address)
+			if !ok {
+				return nil
+			}
+			return giteaClient.DeletePushMirror(ctx, owner, repoName, mirror.RemoteName)
+		})
+	}
+}
+
+// offer lists the recorded resources of a failed run and deletes them in
+// reverse order, right away if auto is set or else after asking on a
+// terminal. The deletions ignore the cancellation of ctx, so that a run
+// interrupted with Ctrl+C can still be rolled back.
+func (r *rollback) offer(ctx context.Context, auto bool) {
+	if len(r.steps) == 0 {
+		return
+	}
+
+	fmt.Fprintln(out, "\n================================================")
+	if r.partial {
+		fmt.Fprintln(out, "Some mirror targets failed. For them, the run created:")
+	} else {
+		fmt.Fprintln(out, "The run did not complete. It created or changed:")
+	}
+	for _, step := range r.steps {
+		fmt.Fprintf(out, "  • %s\n", step.resource)
+	}
+
+	if !auto {
+		if !isTerminal(os.Stdin) || quiet {
+			fmt.Fprintln(out, "\nRerun with --rollback to delete them automatically, or delete them manually.")
+			fmt.Fprintln(out, "================================================")
+			return
+		}
+		fmt.Fprint(out, "\nDelete them? [y/N]: ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			fmt.Fprintln(out, "  ℹ Kept everything")
+			fmt.Fprintln(out, "================================================")
+			return
+		}
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	fmt.Fprintln(out, "\nRolling back...")
+	for i := len(r.steps) - 1; i >= 0; i-- {
+		step := r.steps[i]
+		// A resource that is gone already needs no rollback
+		if err := step.undo(ctx); err != nil && !apierror.IsNotFound(err) {
+			fmt.Fprintf(out, "  ✗ Failed to roll back %s: %v\n", step.resource, err)
+			continue
+		}
+		fmt.Fprintf(out, "  ✓ Rolled back %s\n", step.resource)
+	}
+	fmt.Fprintln(out, "================================================")
+}
+
+// isTerminal reports whether f is an interactive terminal.
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
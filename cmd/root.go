@@ -1,9 +1,42 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Papiermond/gitea-sync/internal/config"
 	"github.com/spf13/cobra"
 )
 
+var (
+	dryRun     bool
+	profile    string
+	configPath string
+
+	// httpTimeout and httpRetries override the http settings of the
+	// config when their flags are given.
+	httpTimeout time.Duration
+	httpRetries int
+
+	// settingFlags maps config keys to the values of the global flags
+	// overriding them, e.g. gitea.url to --gitea-url.
+	settingFlags = make(map[string]*string)
+)
+
+// Config keys without a flag of their own: the mirror targets are chosen
+// with the --target flag of each command, the Gitea owner with --owner,
+// and the http settings have --timeout and --retries.
+var settingsWithoutFlag = map[string]bool{
+	"targets":      true,
+	"gitea.owner":  true,
+	"http.timeout": true,
+	"http.retries": true,
+}
+
 var rootCmd = &cobra.Command{
 	Use:   "gitea-sync",
 	Short: "A CLI tool to manage Gitea and GitHub repository synchronization",
@@ -14,8 +47,101 @@ It allows you to:
   - Set up automatic push mirroring from Gitea to GitHub
   - Bulk configure existing repositories
   - Initialize repositories with common files`,
+	// main prints the returned error
+	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := setupOutput(); err != nil {
+			return err
+		}
+		config.PathOverride = configPath
+		if dryRun {
+			fmt.Fprintln(out, "Dry run: API writes and git commands are printed, not executed.")
+		}
+		return nil
+	},
+}
+
+// Execute runs the command line. Cancelling ctx, e.g. on Ctrl+C, aborts
+// the API requests and git commands in flight.
+func Execute(ctx context.Context) error {
+	err := rootCmd.ExecuteContext(ctx)
+	// A command that fails before printing its result still prints one
+	// JSON result carrying the error
+	if err != nil && jsonOutput() && !resultPrinted {
+		printJSON(struct {
+			Error *errorResult `json:"error"`
+		}{newErrorResult(err)})
+	}
+	return err
 }
 
-func Execute() error {
-	return rootCmd.Execute()
+// selectedProfile returns the profile named by --profile or
+// GITEA_SYNC_PROFILE, or "" for the default profile of the config file.
+func selectedProfile() string {
+	if profile != "" {
+		return profile
+	}
+	return os.Getenv(config.ProfileEnv)
+}
+
+// loadConfig loads the selected profile of the config file, overridden by
+// the environment and the global flags.
+func loadConfig() (*config.Config, error) {
+	flags := rootCmd.PersistentFlags()
+	var overrides []config.Override
+	for _, key := range config.Keys() {
+		if value, ok := settingFlags[key]; ok && flags.Changed(settingFlagName(key)) {
+			overrides = append(overrides, config.Override{Key: key, Value: *value, Source: config.SourceFlag + " --" + settingFlagName(key)})
+		}
+	}
+	if flags.Changed("timeout") {
+		overrides = append(overrides, config.Override{Key: "http.timeout", Value: httpTimeout.String(), Source: config.SourceFlag + " --timeout"})
+	}
+	if flags.Changed("retries") {
+		overrides = append(overrides, config.Override{Key: "http.retries", Value: strconv.Itoa(httpRetries), Source: config.SourceFlag + " --retries"})
+	}
+	return config.Load(selectedProfile(), overrides...)
+}
+
+// findProject reads the project file in dir or one of its parent
+// directories, see config.FindProject.
+func findProject(dir string) (*config.Project, error) {
+	project, err := config.FindProject(dir)
+	if err != nil {
+		return nil, err
+	}
+	if project.Path != "" {
+		fmt.Fprintf(out, "Using project file %s\n", project.Path)
+	}
+	return project, nil
+}
+
+// settingFlagName returns the flag overriding the config key, e.g.
+// gitea-ca-file for gitea.ca_file.
+func settingFlagName(key string) string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(key)
+}
+
+func init() {
+	config.OnMigrate = func(path, backup string, from int) {
+		fmt.Fprintf(os.Stderr, "ℹ Upgraded %s from config version %d to %d, the old file is kept as %s\n", path, from, config.CurrentVersion, backup)
+	}
+
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "Config file to use (default $XDG_CONFIG_HOME/gitea-sync/config.yaml)")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "Config profile to use (default $"+config.ProfileEnv+" or default_profile)")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputText, "Output format: text or json (progress goes to stderr, results to stdout)")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Suppress progress output")
+	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Print API writes and git commands instead of executing them")
+	rootCmd.PersistentFlags().DurationVar(&httpTimeout, "timeout", config.DefaultTimeout, "Timeout of each API request, 0 for none (overrides http.timeout)")
+	rootCmd.PersistentFlags().IntVar(&httpRetries, "retries", config.DefaultRetries, "Retries of API reads failing with network or gateway errors (overrides http.retries)")
+	for _, key := range config.Keys() {
+		// Tokens given as flags would show up in process lists and shell
+		// history; they can come from the environment, token_cmd or
+		// token_file instead
+		if settingsWithoutFlag[key] || config.IsSecret(key) {
+			continue
+		}
+		settingFlags[key] = rootCmd.PersistentFlags().String(settingFlagName(key), "",
+			fmt.Sprintf("Override %s of the config (env %s)", key, config.EnvName(key)))
+	}
 }
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Papiermond/gitea-sync/internal/gitea"
+	"github.com/spf13/cobra"
+)
+
+var statusJSON bool
+
+// repoStatus is the push mirror state of one Gitea repository.
+type repoStatus struct {
+	Repo    string             `json:"repo"`
+	Mirrors []gitea.PushMirror `json:"mirrors"`
+	Error   string             `json:"error,omitempty"`
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show push mirror health for every Gitea repository",
+	Long: `Show push mirror health for every Gitea repository.
+
+Lists the repositories of the configured Gitea user and, for each push
+mirror, its remote address, sync interval, last update and last error.
+
+The command exits with a non-zero status when any mirror reports an error,
+so it can be used from cron.
+
+Examples:
+  gitea-sync status           # Print a table
+  gitea-sync status --json    # Print JSON (same as --output json)`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Load config
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		// Initialize client
+		giteaClient, err := newGiteaClient(cfg)
+		if err != nil {
+			return err
+		}
+
+		repos, err := giteaClient.ListRepos(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to list Gitea repos: %w", err)
+		}
+
+		statuses := make([]repoStatus, 0, len(repos))
+		failures := 0
+		for _, repo := range repos {
+			status := repoStatus{Repo: repo.FullName}
+			mirrors, err := giteaClient.ListPushMirrors(cmd.Context(), repo.Owner.Login, repo.Name)
+			if err != nil {
+				status.Error = err.Error()
+				failures++
+			}
+			for _, mirror := range mirrors {
+				if mirror.LastError != "" {
+					failures++
+				}
+			}
+			status.Mirrors = mirrors
+			if status.Mirrors == nil {
+				status.Mirrors = []gitea.PushMirror{}
+			}
+			statuses = append(statuses, status)
+		}
+
+		if statusJSON || jsonOutput() {
+			if err := printJSON(statuses); err != nil {
+				return err
+			}
+		} else {
+			printStatusTable(statuses)
+		}
+
+		if failures > 0 {
+			return fmt.Errorf("%d push mirror(s) reporting errors", failures)
+		}
+		return nil
+	},
+}
+
+func printStatusTable(statuses []repoStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REPO\tREMOTE\tINTERVAL\tLAST UPDATE\tLAST ERROR")
+	for _, status := range statuses {
+		if status.Error != "" {
+			fmt.Fprintf(w, "%s\t-\t-\t-\t%s\n", status.Repo, status.Error)
+			continue
+		}
+		if len(status.Mirrors) == 0 {
+			fmt.Fprintf(w, "%s\t(no push mirrors)\t-\t-\t-\n", status.Repo)
+			continue
+		}
+		for _, mirror := range status.Mirrors {
+			lastUpdate := "never"
+			if mirror.LastUpdate != nil && !mirror.LastUpdate.IsZero() {
+				lastUpdate = mirror.LastUpdate.Local().Format(time.DateTime)
+			}
+			lastError := strings.Join(strings.Fields(mirror.LastError), " ")
+			if lastError == "" {
+				lastError = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", status.Repo, mirror.RemoteAddress, mirror.Interval, lastUpdate, lastError)
+		}
+	}
+	w.Flush()
+}
+
+func init() {
+	statusCmd.Flags().BoolVar(&statusJSON, "json", false, "Print the status as JSON")
+	rootCmd.AddCommand(statusCmd)
+}
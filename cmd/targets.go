@@ -0,0 +1,280 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Papiermond/gitea-sync/internal/apierror"
+	"github.com/Papiermond/gitea-sync/internal/config"
+	"github.com/Papiermond/gitea-sync/internal/forge"
+	"github.com/Papiermond/gitea-sync/internal/gitea"
+	"github.com/spf13/cobra"
+
+	// Mirror targets register themselves with the forge registry.
+	_ "github.com/Papiermond/gitea-sync/internal/github"
+	_ "github.com/Papiermond/gitea-sync/internal/gitlab"
+)
+
+const defaultTarget = "github"
+
+// mirrorOptions are the push mirror settings that can vary per repository.
+type mirrorOptions struct {
+	Interval     string
+	SyncOnCommit bool
+	// TargetRepo is the repository name on the targets. Empty means the
+	// same name as on Gitea.
+	TargetRepo string
+	// KeepExisting fails instead of replacing a mirror to the same remote
+	// with other settings, so that a rollback never has to restore one.
+	KeepExisting bool
+}
+
+// defaultMirrorOptions syncs on every commit and every 8 hours.
+var defaultMirrorOptions = mirrorOptions{
+	Interval:     "8h",
+	SyncOnCommit: true,
+}
+
+// targetResult records the outcome of setting up one mirror target.
+type targetResult struct {
+	target forge.Provider
+	err    error
+	// repo is stateCreated or stateExisted once the repository on the
+	// target is checked, and mirror the state of the push mirror. Both are
+	// used for rollback and results.
+	repo   string
+	mirror string
+}
+
+// addTargetFlag registers the repeatable --target flag on cmd.
+func addTargetFlag(cmd *cobra.Command, targets *[]string) {
+	cmd.Flags().StringSliceVarP(targets, "target", "t", nil,
+		fmt.Sprintf("Mirror target, repeatable (%s; default from config, else %s)", strings.Join(forge.Names(), ", "), defaultTarget))
+}
+
+// resolveTargets picks the mirror targets from the --target flag and the
+// --github/--gitlab shortcuts, falling back to the targets in the config.
+func resolveTargets(cfg *config.Config, names []string, useGitHub, useGitLab bool) ([]forge.Provider, error) {
+	if useGitHub {
+		names = append(names, "github")
+	}
+	if useGitLab {
+		names = append(names, "gitlab")
+	}
+	if len(names) == 0 {
+		names = cfg.Targets
+	}
+	// Default to GitHub if no target is set
+	if len(names) == 0 {
+		names = []string{defaultTarget}
+	}
+
+	httpClient, err := newHTTPClient(cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []forge.Provider
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		target, err := forge.New(name, cfg, httpClient)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+
+	return targets, nil
+}
+
+// ensureTargetRepo creates repoName in the owner of the mirror target
+// unless it already exists, and returns stateCreated or stateExisted.
+func ensureTargetRepo(ctx context.Context, p forge.Provider, repoName string, private bool) (string, error) {
+	exists, err := p.RepoExists(ctx, p.Owner(), repoName)
+	if err != nil {
+		return "", fmt.Errorf("failed to check %s: %w", p.DisplayName(), withHint(err))
+	}
+
+	if exists {
+		fmt.Fprintf(out, "  ✓ %s repo already exists\n", p.DisplayName())
+		return stateExisted, nil
+	}
+
+	fmt.Fprintf(out, "  → Creating %s repo...\n", p.DisplayName())
+	err = p.CreateRepo(ctx, forge.CreateRepoOptions{
+		Name:    repoName,
+		Private: private,
+	})
+	if apierror.IsConflict(err) {
+		// Created since the check, e.g. by a concurrent run
+		fmt.Fprintf(out, "  ✓ %s repo already exists\n", p.DisplayName())
+		return stateExisted, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s repo: %w", p.DisplayName(), withHint(err))
+	}
+	fmt.Fprintf(out, "  ✓ %s repo created\n", p.DisplayName())
+	return stateCreated, nil
+}
+
+// ensureTargetRepos creates repoName on every target and returns one result
+// per target. A failing target does not stop the others.
+func ensureTargetRepos(ctx context.Context, targets []forge.Provider, repoName string, private bool) []*targetResult {
+	results := make([]*targetResult, 0, len(targets))
+	for _, target := range targets {
+		result := &targetResult{target: target}
+		state, err := ensureTargetRepo(ctx, target, repoName, private)
+		if err != nil {
+			fmt.Fprintf(out, "  ✗ %v\n", err)
+			result.err = err
+		}
+		result.repo = state
+		results = append(results, result)
+	}
+	return results
+}
+
+// newTargetResults returns an empty result for every target.
+func newTargetResults(targets []forge.Provider) []*targetResult {
+	results := make([]*targetResult, 0, len(targets))
+	for _, target := range targets {
+		results = append(results, &targetResult{target: target})
+	}
+	return results
+}
+
+// addPushMirrors registers one Gitea push mirror per target that has not
+// failed yet, recording any error in the target's result.
+func addPushMirrors(ctx context.Context, w io.Writer, giteaClient *gitea.Client, owner, repoName string, opts mirrorOptions, results []*targetResult) {
+	for _, result := range results {
+		if result.err != nil {
+			continue
+		}
+		state, err := ensurePushMirror(ctx, w, giteaClient, owner, repoName, opts, result.target)
+		result.mirror = state
+		if err != nil {
+			result.err = fmt.Errorf("failed to set up %s mirror: %w", result.target.DisplayName(), err)
+			fmt.Fprintf(w, "  ✗ %v\n", result.err)
+		}
+	}
+}
+
+// ensurePushMirror adds the push mirror for target unless an identical one
+// exists. A mirror to the same remote with other settings is replaced,
+// unless opts.KeepExisting is set. It returns stateAdded, stateReplaced or
+// stateUnchanged.
+func ensurePushMirror(ctx context.Context, w io.Writer, giteaClient *gitea.Client, owner, repoName string, opts mirrorOptions, target forge.Provider) (string, error) {
+	req := pushMirrorRequest(target, repoName, opts)
+
+	// In a dry run the Gitea repository may only have been pretended to be
+	// created, so it has no mirrors to list
+	mirrors, err := giteaClient.ListPushMirrors(ctx, owner, repoName)
+	if err != nil && !(dryRun && apierror.IsNotFound(err)) {
+		return "", err
+	}
+	existing, replace := gitea.FindPushMirror(mirrors, req.RemoteAddress)
+	if replace {
+		if existing.Matches(req) {
+			fmt.Fprintf(w, "  ✓ %s mirror already configured\n", target.DisplayName())
+			return stateUnchanged, nil
+		}
+		if opts.KeepExisting {
+			return "", fmt.Errorf("a mirror to %s exists with interval %s and sync on commit %t; run `gitea-sync mirror %s` to replace it",
+				existing.RemoteAddress, existing.Interval, existing.SyncOnCommit, repoName)
+		}
+		fmt.Fprintf(w, "  → Replacing %s mirror (interval %s, sync on commit %t)...\n",
+			target.DisplayName(), existing.Interval, existing.SyncOnCommit)
+		if err := giteaClient.DeletePushMirror(ctx, owner, repoName, existing.RemoteName); err != nil {
+			return "", err
+		}
+	}
+
+	if err := giteaClient.AddPushMirror(ctx, owner, repoName, req); err != nil {
+		return "", err
+	}
+	fmt.Fprintf(w, "  ✓ %s mirror configured\n", target.DisplayName())
+	if replace {
+		return stateReplaced, nil
+	}
+	return stateAdded, nil
+}
+
+// pushMirrorRequest builds the Gitea push mirror request for repoName on p.
+func pushMirrorRequest(p forge.Provider, repoName string, opts mirrorOptions) gitea.PushMirrorRequest {
+	username, token := p.Credentials()
+	if opts.TargetRepo != "" {
+		repoName = opts.TargetRepo
+	}
+	return gitea.PushMirrorRequest{
+		RemoteAddress:  p.CloneURL(p.Owner(), repoName),
+		RemotePassword: token,
+		RemoteUsername: username,
+		SyncOnCommit:   opts.SyncOnCommit,
+		Interval:       opts.Interval,
+	}
+}
+
+// targetWebURL returns the browser URL of repoName on p.
+func targetWebURL(p forge.Provider, repoName string) string {
+	return p.WebURL(p.Owner(), repoName)
+}
+
+// targetNames joins the display names of targets for messages.
+func targetNames(targets []forge.Provider) string {
+	names := make([]string, 0, len(targets))
+	for _, target := range targets {
+		names = append(names, target.DisplayName())
+	}
+	return strings.Join(names, ", ")
+}
+
+// succeededTargets returns the targets whose results carry no error.
+func succeededTargets(results []*targetResult) []forge.Provider {
+	var targets []forge.Provider
+	for _, result := range results {
+		if result.err == nil {
+			targets = append(targets, result.target)
+		}
+	}
+	return targets
+}
+
+// printTargetURLs prints the web URL of every target, marking failed ones.
+func printTargetURLs(results []*targetResult, repoName string) {
+	for _, result := range results {
+		if result.err != nil {
+			fmt.Fprintf(out, "  %-7s ✗ %v\n", result.target.DisplayName()+":", result.err)
+			continue
+		}
+		fmt.Fprintf(out, "  %-7s %s\n", result.target.DisplayName()+":", targetWebURL(result.target, repoName))
+	}
+}
+
+// targetsError returns an error naming the failed and succeeded targets, or
+// nil when every target succeeded.
+func targetsError(results []*targetResult) error {
+	var succeeded, failed []string
+	for _, result := range results {
+		if result.err != nil {
+			failed = append(failed, result.target.Name())
+		} else {
+			succeeded = append(succeeded, result.target.Name())
+		}
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+	if len(succeeded) == 0 {
+		return fmt.Errorf("mirroring failed for all targets: %s", strings.Join(failed, ", "))
+	}
+	return fmt.Errorf("mirroring failed for %s (succeeded: %s)", strings.Join(failed, ", "), strings.Join(succeeded, ", "))
+}
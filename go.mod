@@ -3,11 +3,14 @@ module github.com/Papiermond/gitea-sync
 go 1.25.3
 
 require (
+	github.com/godbus/dbus/v5 v5.1.0
 	github.com/spf13/cobra v1.10.1
+	golang.org/x/term v0.36.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.9 // indirect
+	golang.org/x/sys v0.37.0 // indirect
 )
@@ -0,0 +1,207 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// maxBody limits how much of an unparsable response body ends up in an
+// error message.
+const maxBody = 512
+
+// Error is a failed API call: the platform answered with an unexpected
+// HTTP status.
+type Error struct {
+	// Platform is the display name of the forge, e.g. "GitHub".
+	Platform string
+	// Action describes the failed call, e.g. "create repo".
+	Action     string
+	StatusCode int
+	// Message is the error message parsed from the response body.
+	Message string
+
+	rateLimited bool
+}
+
+// New returns the error for resp, reading and parsing its body. The caller
+// still closes the body.
+func New(platform, action string, resp *http.Response) *Error {
+	body, _ := io.ReadAll(resp.Body)
+	e := &Error{
+		Platform:   platform,
+		Action:     action,
+		StatusCode: resp.StatusCode,
+		Message:    parseMessage(body),
+	}
+
+	// GitHub answers 403 for both its primary limit (remaining quota of
+	// zero) and its secondary limits (mentioned in the message)
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		e.rateLimited = true
+	case http.StatusForbidden:
+		e.rateLimited = resp.Header.Get("X-RateLimit-Remaining") == "0" ||
+			resp.Header.Get("Retry-After") != "" ||
+			strings.Contains(strings.ToLower(e.Message), "rate limit")
+	}
+	return e
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("failed to %s (status %d)", e.Action, e.StatusCode)
+	}
+	return fmt.Sprintf("failed to %s (status %d): %s", e.Action, e.StatusCode, e.Message)
+}
+
+// HTTPStatus returns the HTTP status code of the response.
+func (e *Error) HTTPStatus() int {
+	return e.StatusCode
+}
+
+// As returns the API error in err's chain, if any.
+func As(err error) (*Error, bool) {
+	var e *Error
+	ok := errors.As(err, &e)
+	return e, ok
+}
+
+// IsNotFound reports whether err is an API error for a missing resource.
+func IsNotFound(err error) bool {
+	e, ok := As(err)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// IsConflict reports whether err is an API error for a resource that
+// already exists. Gitea answers 409, while GitHub (422) and GitLab (400)
+// only say so in the message.
+func IsConflict(err error) bool {
+	e, ok := As(err)
+	if !ok {
+		return false
+	}
+	switch e.StatusCode {
+	case http.StatusConflict:
+		return true
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		message := strings.ToLower(e.Message)
+		return strings.Contains(message, "already exist") || strings.Contains(message, "already been taken")
+	}
+	return false
+}
+
+// IsAuth reports whether err is an API error for a missing, invalid or
+// insufficient token.
+func IsAuth(err error) bool {
+	e, ok := As(err)
+	return ok && !e.rateLimited &&
+		(e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden)
+}
+
+// IsRateLimited reports whether err is an API error for an exceeded rate
+// limit.
+func IsRateLimited(err error) bool {
+	e, ok := As(err)
+	return ok && e.rateLimited
+}
+
+// parseMessage extracts the error message from the JSON body of an API
+// error. Gitea and GitHub send {"message": "..."}, GitHub adds details in
+// "errors", and GitLab sends "message" as a string or as an object of
+// field errors, or an OAuth style "error". Other bodies are returned as
+// text.
+func parseMessage(body []byte) string {
+	var fields struct {
+		Message          json.RawMessage   `json:"message"`
+		Error            string            `json:"error"`
+		ErrorDescription string            `json:"error_description"`
+		Errors           []json.RawMessage `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		text := strings.TrimSpace(string(body))
+		if len(text) > maxBody {
+			text = text[:maxBody] + "..."
+		}
+		return text
+	}
+
+	var parts []string
+	if message := flatten(fields.Message); message != "" {
+		parts = append(parts, message)
+	}
+	for _, detail := range fields.Errors {
+		if message := errorDetail(detail); message != "" {
+			parts = append(parts, message)
+		}
+	}
+	if len(parts) == 0 && fields.Error != "" {
+		parts = append(parts, fields.Error)
+		if fields.ErrorDescription != "" {
+			parts = append(parts, fields.ErrorDescription)
+		}
+	}
+	// "Repository creation failed.: name ..." reads badly
+	for i := 0; i < len(parts)-1; i++ {
+		parts[i] = strings.TrimSuffix(parts[i], ".")
+	}
+	return strings.Join(parts, ": ")
+}
+
+// flatten turns a message that is a string, a list of strings or an object
+// of field errors such as {"name": ["has already been taken"]} into text.
+func flatten(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return strings.Join(list, ", ")
+	}
+
+	var fieldErrors map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fieldErrors); err == nil {
+		keys := make([]string, 0, len(fieldErrors))
+		for key := range fieldErrors {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		parts := make([]string, 0, len(keys))
+		for _, key := range keys {
+			parts = append(parts, key+" "+flatten(fieldErrors[key]))
+		}
+		return strings.Join(parts, "; ")
+	}
+
+	return string(raw)
+}
+
+// errorDetail returns the text of one entry of GitHub's "errors" list,
+// which is a string or an object with a message or a field and code.
+func errorDetail(raw json.RawMessage) string {
+	var detail struct {
+		Message string `json:"message"`
+		Field   string `json:"field"`
+		Code    string `json:"code"`
+	}
+	if err := json.Unmarshal(raw, &detail); err != nil {
+		return flatten(raw)
+	}
+	if detail.Message != "" {
+		return detail.Message
+	}
+	if detail.Field != "" && detail.Code != "" {
+		return detail.Field + " " + strings.ReplaceAll(detail.Code, "_", " ")
+	}
+	return ""
+}
@@ -0,0 +1,285 @@
+package bulkfile
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Entry is one repository of a bulk run with its per-repository options.
+type Entry struct {
+	// Line is the line of the entry in the input file, for error messages.
+	Line int    `json:"line,omitempty"`
+	Name string `json:"name"`
+	// TargetName is the repository name on the mirror targets. Empty means
+	// the same as Name.
+	TargetName   string   `json:"target_name,omitempty"`
+	Private      bool     `json:"private"`
+	Targets      []string `json:"targets,omitempty"`
+	Interval     string   `json:"interval"`
+	SyncOnCommit bool     `json:"sync_on_commit"`
+	Description  string   `json:"description,omitempty"`
+}
+
+// CSV columns. Only "name" is required; several targets are separated by
+// ";" or spaces.
+var columns = []string{"name", "target_name", "visibility", "targets", "interval", "sync_on_commit", "description"}
+
+// yamlEntry is the YAML form of an entry. Pointers tell unset fields apart.
+type yamlEntry struct {
+	Name         string   `yaml:"name"`
+	TargetName   string   `yaml:"target_name"`
+	Visibility   string   `yaml:"visibility"`
+	Targets      []string `yaml:"targets"`
+	Interval     string   `yaml:"interval"`
+	SyncOnCommit *bool    `yaml:"sync_on_commit"`
+	Description  string   `yaml:"description"`
+}
+
+// NewEntry returns an entry for name with the default options: public,
+// synced on commit and every 8 hours.
+func NewEntry(name string) Entry {
+	return Entry{
+		Name:         name,
+		Interval:     "8h",
+		SyncOnCommit: true,
+	}
+}
+
+// Load reads a CSV (.csv) or YAML (.yaml, .yml) bulk file. All invalid rows
+// are reported together, each with its line number.
+func Load(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		entries, err = parseCSV(f)
+	case ".yaml", ".yml":
+		entries, err = parseYAML(f)
+	default:
+		return nil, fmt.Errorf("%s: unsupported file type (use .csv, .yaml or .yml)", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return entries, nil
+}
+
+func parseCSV(r io.Reader) ([]Entry, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	index := make(map[string]int)
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(column))
+		if !slices.Contains(columns, column) {
+			return nil, fmt.Errorf("line 1: unknown column %q (allowed: %s)", column, strings.Join(columns, ", "))
+		}
+		index[column] = i
+	}
+	if _, ok := index["name"]; !ok {
+		return nil, fmt.Errorf("line 1: missing \"name\" column")
+	}
+
+	var entries []Entry
+	var problems []error
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		field := func(column string) string {
+			i, ok := index[column]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		entry := NewEntry(field("name"))
+		entry.Line = line
+		entry.TargetName = field("target_name")
+		entry.Description = field("description")
+		if interval := field("interval"); interval != "" {
+			entry.Interval = interval
+		}
+		entry.Targets = strings.FieldsFunc(field("targets"), func(r rune) bool { return r == ';' || r == ' ' })
+
+		var rowProblems []string
+		if value := field("sync_on_commit"); value != "" {
+			sync, err := strconv.ParseBool(value)
+			if err != nil {
+				rowProblems = append(rowProblems, fmt.Sprintf("sync_on_commit must be true or false, got %q", value))
+			}
+			entry.SyncOnCommit = sync
+		}
+		private, err := parseVisibility(field("visibility"))
+		if err != nil {
+			rowProblems = append(rowProblems, err.Error())
+		}
+		entry.Private = private
+
+		rowProblems = append(rowProblems, validate(entry)...)
+		for _, problem := range rowProblems {
+			problems = append(problems, fmt.Errorf("line %d: %s", line, problem))
+		}
+		entries = append(entries, entry)
+	}
+
+	problems = append(problems, duplicates(entries)...)
+	if len(problems) > 0 {
+		return nil, errors.Join(problems...)
+	}
+	return entries, nil
+}
+
+func parseYAML(r io.Reader) ([]Entry, error) {
+	var doc struct {
+		Repos []yaml.Node `yaml:"repos"`
+	}
+	var file yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&file); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	if len(file.Content) > 0 {
+		root := file.Content[0]
+		if root.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(root.Content); i += 2 {
+				if key := root.Content[i]; key.Value != "repos" {
+					return nil, fmt.Errorf("line %d: unknown key %q (allowed: repos)", key.Line, key.Value)
+				}
+			}
+		}
+		if err := root.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML: %w", err)
+		}
+	}
+
+	var entries []Entry
+	var problems []error
+	for _, node := range doc.Repos {
+		// yaml.Node.Decode silently drops unknown keys, such as a misspelled
+		// visibility, so they are checked like the CSV columns
+		if unknown := unknownKeys(node); len(unknown) > 0 {
+			problems = append(problems, unknown...)
+			continue
+		}
+		var raw yamlEntry
+		if err := node.Decode(&raw); err != nil {
+			problems = append(problems, fmt.Errorf("line %d: %v", node.Line, err))
+			continue
+		}
+
+		entry := NewEntry(raw.Name)
+		entry.Line = node.Line
+		entry.TargetName = raw.TargetName
+		entry.Targets = raw.Targets
+		entry.Description = raw.Description
+		if raw.Interval != "" {
+			entry.Interval = raw.Interval
+		}
+		if raw.SyncOnCommit != nil {
+			entry.SyncOnCommit = *raw.SyncOnCommit
+		}
+
+		var rowProblems []string
+		private, err := parseVisibility(raw.Visibility)
+		if err != nil {
+			rowProblems = append(rowProblems, err.Error())
+		}
+		entry.Private = private
+
+		rowProblems = append(rowProblems, validate(entry)...)
+		for _, problem := range rowProblems {
+			problems = append(problems, fmt.Errorf("line %d: %s", node.Line, problem))
+		}
+		entries = append(entries, entry)
+	}
+
+	problems = append(problems, duplicates(entries)...)
+	if len(problems) > 0 {
+		return nil, errors.Join(problems...)
+	}
+	return entries, nil
+}
+
+// unknownKeys reports the keys of the mapping node that are no column.
+func unknownKeys(node yaml.Node) []error {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	var problems []error
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if key := node.Content[i]; !slices.Contains(columns, key.Value) {
+			problems = append(problems, fmt.Errorf("line %d: unknown key %q (allowed: %s)", key.Line, key.Value, strings.Join(columns, ", ")))
+		}
+	}
+	return problems
+}
+
+func parseVisibility(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "", "public":
+		return false, nil
+	case "private":
+		return true, nil
+	}
+	return false, fmt.Errorf("visibility must be \"public\" or \"private\", got %q", value)
+}
+
+func validate(entry Entry) []string {
+	var problems []string
+	if entry.Name == "" {
+		problems = append(problems, "name is required")
+	} else if strings.ContainsAny(entry.Name, "/ ") {
+		problems = append(problems, fmt.Sprintf("invalid repository name %q", entry.Name))
+	}
+	if strings.ContainsAny(entry.TargetName, "/ ") {
+		problems = append(problems, fmt.Sprintf("invalid target_name %q", entry.TargetName))
+	}
+	if _, err := time.ParseDuration(entry.Interval); err != nil {
+		problems = append(problems, fmt.Sprintf("invalid interval %q", entry.Interval))
+	}
+	return problems
+}
+
+func duplicates(entries []Entry) []error {
+	var problems []error
+	seen := make(map[string]int)
+	for _, entry := range entries {
+		if entry.Name == "" {
+			continue
+		}
+		if first, ok := seen[entry.Name]; ok {
+			problems = append(problems, fmt.Errorf("line %d: repository %q already listed on line %d", entry.Line, entry.Name, first))
+			continue
+		}
+		seen[entry.Name] = entry.Line
+	}
+	return problems
+}
@@ -1,45 +1,363 @@
 package config
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io/fs"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+// DefaultProfile names the profile kept at the top level of the config
+// file.
+const DefaultProfile = "default"
+
+// ProfileEnv names the environment variable that selects the profile when
+// no --profile flag is given.
+const ProfileEnv = "GITEA_SYNC_PROFILE"
+
+// File is the content of the config file. The settings at the top level
+// form the default profile, further named profiles are listed under
+// "profiles".
+type File struct {
+	// Version is the version of the file layout, see CurrentVersion.
+	Version int `yaml:"version,omitempty"`
+	Config  `yaml:",inline"`
+	// Default names the profile used when none is selected. Empty means
+	// DefaultProfile.
+	Default  string            `yaml:"default_profile,omitempty"`
+	Profiles map[string]Config `yaml:"profiles,omitempty"`
+}
+
+// Profile returns a copy of the settings of the named profile. An empty
+// name selects the default profile of the file.
+func (f *File) Profile(name string) (*Config, error) {
+	if name == "" {
+		name = f.Default
+	}
+	if name == "" {
+		name = DefaultProfile
+	}
+	if _, ok := f.Profiles[DefaultProfile]; ok {
+		return nil, fmt.Errorf("profiles.%s: the name %q is reserved for the top-level settings", DefaultProfile, DefaultProfile)
+	}
+
+	cfg := f.Config
+	if name != DefaultProfile {
+		var ok bool
+		cfg, ok = f.Profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(f.ProfileNames(), ", "))
+		}
+	}
+	cfg.Profile = name
+	return &cfg, nil
+}
+
+// ProfileNames returns the default profile and the named profiles in
+// sorted order.
+func (f *File) ProfileNames() []string {
+	names := []string{DefaultProfile}
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// validProfileName checks that name can be used as a YAML key and a
+// command line argument.
+func validProfileName(name string) error {
+	if name == "" || strings.ContainsAny(name, " \t\n/'\"") {
+		return fmt.Errorf("invalid profile name %q", name)
+	}
+	return nil
+}
+
 type Config struct {
+	// Profile is the name of the profile the settings were loaded from.
+	Profile string `yaml:"-"`
+	// Sources maps the keys of the settings that are set to where their
+	// value comes from: SourceFile, a project file, or an environment
+	// variable or flag.
+	Sources map[string]string `yaml:"-"`
+
 	Gitea  GiteaConfig  `yaml:"gitea"`
 	GitHub GitHubConfig `yaml:"github"`
 	GitLab GitLabConfig `yaml:"gitlab"`
+	// Targets lists the mirror targets used when no --target flag is given.
+	Targets []string   `yaml:"targets,omitempty"`
+	HTTP    HTTPConfig `yaml:"http,omitempty"`
+}
+
+// Defaults of the HTTP settings.
+const (
+	DefaultTimeout = 30 * time.Second
+	DefaultRetries = 3
+)
+
+// HTTPConfig tunes the API requests to all forges.
+type HTTPConfig struct {
+	// Timeout limits each API request, e.g. "30s" or "2m". "0" disables
+	// the limit. Empty means DefaultTimeout.
+	Timeout string `yaml:"timeout,omitempty"`
+	// Retries limits the retries of API reads that fail with a network
+	// error or a 502, 503 or 504 status. Nil means DefaultRetries.
+	Retries *int `yaml:"retries,omitempty"`
+}
+
+// TimeoutDuration parses the request timeout.
+func (h HTTPConfig) TimeoutDuration() (time.Duration, error) {
+	if h.Timeout == "" {
+		return DefaultTimeout, nil
+	}
+	timeout, err := time.ParseDuration(h.Timeout)
+	if h.Timeout == "0" {
+		timeout, err = 0, nil
+	}
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("http.timeout: invalid duration %q", h.Timeout)
+	}
+	return timeout, nil
+}
+
+// RetryCount returns the number of retries of API reads.
+func (h HTTPConfig) RetryCount() (int, error) {
+	if h.Retries == nil {
+		return DefaultRetries, nil
+	}
+	if *h.Retries < 0 {
+		return 0, fmt.Errorf("http.retries: must not be negative, got %d", *h.Retries)
+	}
+	return *h.Retries, nil
 }
 
 type GiteaConfig struct {
-	URL      string `yaml:"url"`
-	Token    string `yaml:"token"`
-	Username string `yaml:"username"`
+	URL         string `yaml:"url"`
+	TokenConfig `yaml:",inline"`
+	Username    string `yaml:"username"`
+	// Owner is the organization owning the repositories gitea-sync creates
+	// and mirrors. Empty means Username.
+	Owner string `yaml:"owner,omitempty"`
+	// CAFile is a PEM bundle of extra CAs trusted for the Gitea host.
+	CAFile string `yaml:"ca_file,omitempty"`
+	// ClientCert and ClientKey are a PEM client certificate and key
+	// presented to the Gitea host.
+	ClientCert string `yaml:"client_cert,omitempty"`
+	ClientKey  string `yaml:"client_key,omitempty"`
 }
 
 type GitHubConfig struct {
-	Token    string `yaml:"token"`
-	Username string `yaml:"username"`
+	TokenConfig `yaml:",inline"`
+	Username    string `yaml:"username"`
+	// Owner is the organization the mirrors are created in. Empty means
+	// Username.
+	Owner string `yaml:"owner,omitempty"`
 }
 
 type GitLabConfig struct {
-	URL      string `yaml:"url"`
-	Token    string `yaml:"token"`
-	Username string `yaml:"username"`
+	URL         string `yaml:"url"`
+	TokenConfig `yaml:",inline"`
+	Username    string `yaml:"username"`
+	// Owner is the path of the group or subgroup the mirrors are created
+	// in, e.g. "my-team/backend". Empty means Username.
+	Owner string `yaml:"owner,omitempty"`
 }
 
+// Endpoint is a parsed forge base URL such as https://host:8443/gitea.
+type Endpoint struct {
+	Scheme   string
+	Host     string // host name without port
+	Port     string // empty for the scheme's default port
+	BasePath string // "" or a path like "/gitea", without trailing slash
+}
+
+// ParseEndpoint parses and normalizes a forge base URL. Only http and https
+// URLs without credentials, query or fragment are accepted.
+func ParseEndpoint(raw string) (*Endpoint, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, fmt.Errorf("URL is empty")
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %q: %w", raw, err)
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return nil, fmt.Errorf("invalid URL %q: must start with http:// or https://", raw)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid URL %q: missing host", raw)
+	}
+	if u.User != nil {
+		return nil, fmt.Errorf("invalid URL %q: credentials belong in the token field", raw)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("invalid URL %q: query and fragment are not allowed", raw)
+	}
+
+	port := u.Port()
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		port = ""
+	}
+
+	return &Endpoint{
+		Scheme:   scheme,
+		Host:     strings.ToLower(u.Hostname()),
+		Port:     port,
+		BasePath: strings.TrimRight(u.Path, "/"),
+	}, nil
+}
+
+// HostPort returns the host with the port, if it is not the default one.
+// This is the form git uses for the host of credential requests.
+func (e *Endpoint) HostPort() string {
+	if e.Port == "" {
+		return e.Host
+	}
+	return e.Host + ":" + e.Port
+}
+
+// BaseURL returns the normalized base URL without trailing slash.
+func (e *Endpoint) BaseURL() string {
+	return fmt.Sprintf("%s://%s%s", e.Scheme, e.HostPort(), e.BasePath)
+}
+
+// RepoURL returns the browser URL of owner/repo.
+func (e *Endpoint) RepoURL(owner, repo string) string {
+	return fmt.Sprintf("%s/%s/%s", e.BaseURL(), url.PathEscape(owner), url.PathEscape(repo))
+}
+
+// CloneURL returns the HTTP(S) clone URL of owner/repo.
+func (e *Endpoint) CloneURL(owner, repo string) string {
+	return e.RepoURL(owner, repo) + ".git"
+}
+
+// Matches reports whether u points at the host and port of the endpoint.
+// Credentials in u are ignored.
+func (e *Endpoint) Matches(u *url.URL) bool {
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	return strings.EqualFold(u.Hostname(), e.Host) && port == e.Port
+}
+
+// RepoOwner returns the owner of the repositories on Gitea: Owner if set,
+// else Username.
+func (g GiteaConfig) RepoOwner() string {
+	if g.Owner != "" {
+		return g.Owner
+	}
+	return g.Username
+}
+
+// IsOrgOwner reports whether the repositories belong to an organization
+// rather than to the user of the token.
+func (g GiteaConfig) IsOrgOwner() bool {
+	return g.Owner != "" && !strings.EqualFold(g.Owner, g.Username)
+}
+
+// Endpoint parses the Gitea URL.
+func (g GiteaConfig) Endpoint() (*Endpoint, error) {
+	e, err := ParseEndpoint(g.URL)
+	if err != nil {
+		return nil, fmt.Errorf("gitea.url: %w", err)
+	}
+	return e, nil
+}
+
+// TLSConfig returns the TLS settings for the Gitea host, or nil when no CA
+// bundle or client certificate is configured.
+func (g GiteaConfig) TLSConfig() (*tls.Config, error) {
+	if g.CAFile == "" && g.ClientCert == "" && g.ClientKey == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{}
+	if g.CAFile != "" {
+		pem, err := os.ReadFile(g.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("gitea.ca_file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("gitea.ca_file: no certificates found in %s", g.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if g.ClientCert != "" || g.ClientKey != "" {
+		if g.ClientCert == "" || g.ClientKey == "" {
+			return nil, fmt.Errorf("gitea.client_cert and gitea.client_key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(g.ClientCert, g.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load Gitea client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// PathOverride, if set, is the path of the config file, e.g. given with
+// the --config flag.
+var PathOverride string
+
+// ConfigPath returns the path of the config file: PathOverride if set, else
+// $XDG_CONFIG_HOME/gitea-sync/config.yaml, with XDG_CONFIG_HOME defaulting
+// to ~/.config. A config file in the old location ~/.gitea-sync.yaml is used
+// as long as the new one does not exist.
 func ConfigPath() (string, error) {
+	if PathOverride != "" {
+		return filepath.Abs(PathOverride)
+	}
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(home, ".gitea-sync.yaml"), nil
+
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	// The XDG spec asks to ignore relative paths
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(home, ".config")
+	}
+	path := filepath.Join(dir, "gitea-sync", "config.yaml")
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		legacy := legacyConfigPath(home)
+		if _, err := os.Stat(legacy); err == nil {
+			return legacy, nil
+		}
+	}
+	return path, nil
+}
+
+// legacyConfigPath returns the path of the config file used before
+// gitea-sync followed the XDG base directory spec.
+func legacyConfigPath(home string) string {
+	return filepath.Join(home, ".gitea-sync.yaml")
 }
 
-func Load() (*Config, error) {
+// ReadFile reads and parses the config file without validating the
+// settings. A file of an older version is upgraded in place first, see
+// CurrentVersion. Unknown keys are rejected. The error wraps fs.ErrNotExist
+// if there is no config file.
+func ReadFile() (*File, error) {
 	path, err := ConfigPath()
 	if err != nil {
 		return nil, err
@@ -47,30 +365,244 @@ func Load() (*Config, error) {
 
 	data, err := os.ReadFile(path)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("config file not found. Run 'gitea-sync init' to create it")
-		}
 		return nil, err
 	}
 
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	var f File
+	if len(doc.Content) == 0 {
+		return &f, nil
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("failed to parse config: %s is not a mapping", path)
+	}
+	// Keys are checked against the current layout, so old files are
+	// upgraded first
+	if err := migrate(path, data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := checkKeys(doc.Content[0]); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	if err := doc.Decode(&f); err != nil {
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
+	return &f, nil
+}
 
+// ParseSettings parses the settings of one profile, e.g. given to init as
+// JSON. YAML is accepted as well. Unknown keys are rejected.
+func ParseSettings(data []byte) (*Config, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse settings: %w", err)
+	}
+	var cfg Config
+	if len(doc.Content) == 0 {
+		return &cfg, nil
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("failed to parse settings: not an object")
+	}
+	if err := checkSettingKeys(doc.Content[0], "", nil); err != nil {
+		return nil, fmt.Errorf("failed to parse settings: %w", err)
+	}
+	if err := doc.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse settings: %w", err)
+	}
 	return &cfg, nil
 }
 
-func Save(cfg *Config) error {
+// Load returns the validated settings of the named profile. An empty name
+// selects the default profile of the file. Each setting is taken from the
+// first of: overrides, its environment variable (see EnvName), the config
+// file. The config file is optional if the environment or the overrides
+// provide the Gitea URL.
+func Load(profile string, overrides ...Override) (*Config, error) {
+	f, err := ReadFile()
+	fileFound := err == nil
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		f = &File{}
+	case err != nil:
+		return nil, err
+	}
+
+	cfg, err := f.Profile(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Sources = make(map[string]string)
+	for _, key := range Keys() {
+		if fileFound && cfg.Get(key) != "" {
+			cfg.Sources[key] = SourceFile
+		}
+		// An empty variable counts as unset, as CI systems often define
+		// all variables
+		if value := os.Getenv(EnvName(key)); value != "" {
+			if err := cfg.setFrom(key, value, SourceEnv+" "+EnvName(key)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, o := range overrides {
+		if err := cfg.setFrom(o.Key, o.Value, o.Source); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.overrideTokenSources(); err != nil {
+		return nil, err
+	}
+
+	if !fileFound && cfg.Gitea.URL == "" {
+		return nil, fmt.Errorf("config file not found. Run 'gitea-sync init' to create it, or set %s", EnvName("gitea.url"))
+	}
+
+	if _, err := cfg.Gitea.Endpoint(); err != nil {
+		return nil, err
+	}
+	if _, err := cfg.HTTP.TimeoutDuration(); err != nil {
+		return nil, err
+	}
+	if _, err := cfg.HTTP.RetryCount(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// SaveProfile writes cfg as the named profile into the config file,
+// creating the file if needed. The other profiles and settings, including
+// comments, are left as they are. With makeDefault, the profile becomes
+// the default profile.
+func SaveProfile(name string, cfg *Config, makeDefault bool) error {
+	if err := validProfileName(name); err != nil {
+		return err
+	}
 	path, err := ConfigPath()
 	if err != nil {
 		return err
 	}
 
-	data, err := yaml.Marshal(cfg)
-	if err != nil {
+	var doc yaml.Node
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("failed to parse config: %w", err)
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("failed to parse config: %s is not a mapping", path)
+	}
+	if len(data) > 0 {
+		if err := migrate(path, data, &doc); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		// Saving would otherwise keep a misspelled key of another setting
+		if err := checkKeys(root); err != nil {
+			return fmt.Errorf("failed to parse config %s: %w", path, err)
+		}
+	}
+	setVersion(root)
+
+	var value yaml.Node
+	if err := value.Encode(cfg); err != nil {
 		return err
 	}
 
+	if name == DefaultProfile {
+		// The default profile is spread over the top level, next to the
+		// named profiles. Settings left empty are omitted from value.
+		present := make(map[string]bool)
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			present[value.Content[i].Value] = true
+			setKey(root, value.Content[i].Value, value.Content[i+1])
+		}
+		for _, key := range configKeys() {
+			if !present[key] {
+				deleteKey(root, key)
+			}
+		}
+	} else {
+		profiles := lookupKey(root, "profiles")
+		if profiles == nil {
+			profiles = &yaml.Node{Kind: yaml.MappingNode}
+			setKey(root, "profiles", profiles)
+		}
+		setKey(profiles, name, &value)
+	}
+
+	if makeDefault {
+		if name == DefaultProfile {
+			deleteKey(root, "default_profile")
+		} else {
+			setKey(root, "default_profile", &yaml.Node{Kind: yaml.ScalarNode, Value: name})
+		}
+	}
+
+	data, err = yaml.Marshal(&doc)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
 	return os.WriteFile(path, data, 0600)
 }
+
+// configKeys returns the YAML keys of the fields of Config.
+func configKeys() []string {
+	var keys []string
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if key != "" && key != "-" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// lookupKey returns the value of key in the mapping node m, or nil.
+func lookupKey(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setKey sets key to value in the mapping node m, keeping its position if
+// it exists and appending it otherwise.
+func setKey(m *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content[i+1] = value
+			return
+		}
+	}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+}
+
+// deleteKey removes key from the mapping node m.
+func deleteKey(m *yaml.Node, key string) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content = append(m.Content[:i], m.Content[i+2:]...)
+			return
+		}
+	}
+}
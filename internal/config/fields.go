@@ -0,0 +1,160 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix starts the names of the environment variables that override
+// settings, e.g. GITEA_SYNC_GITEA_URL for gitea.url.
+const EnvPrefix = "GITEA_SYNC_"
+
+// Sources of a setting, in increasing precedence.
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceProject = "project"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// Override replaces the setting Key of the config file, e.g. with the
+// value of a command line flag.
+type Override struct {
+	Key   string
+	Value string
+	// Source describes where the value comes from, e.g. "flag --gitea-url".
+	Source string
+}
+
+// Keys returns the keys of all settings of a profile in the order of the
+// config file, e.g. "gitea.url".
+func Keys() []string {
+	var keys []string
+	walkFields(reflect.TypeOf(Config{}), "", func(key string, _ []int) {
+		keys = append(keys, key)
+	})
+	return keys
+}
+
+// EnvName returns the environment variable overriding the setting key.
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// IsSecret reports whether the setting key holds a secret that must not be
+// shown.
+func IsSecret(key string) bool {
+	return key == "token" || strings.HasSuffix(key, ".token")
+}
+
+// DefaultValue returns the value used for the setting key when it is not
+// set, or "" if there is none.
+func DefaultValue(key string) string {
+	switch key {
+	case "http.timeout":
+		return DefaultTimeout.String()
+	case "http.retries":
+		return strconv.Itoa(DefaultRetries)
+	}
+	return ""
+}
+
+// Get returns the setting key as text. Lists are joined with commas.
+func (c *Config) Get(key string) string {
+	v, ok := c.field(key)
+	if !ok {
+		return ""
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Slice:
+		return strings.Join(v.Interface().([]string), ",")
+	case reflect.Pointer:
+		if v.IsNil() {
+			return ""
+		}
+		return strconv.FormatInt(v.Elem().Int(), 10)
+	}
+	return ""
+}
+
+// Set parses value into the setting key. Lists are split at commas.
+func (c *Config) Set(key, value string) error {
+	v, ok := c.field(key)
+	if !ok {
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	case reflect.Pointer:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%s: invalid number %q", key, value)
+		}
+		v.Set(reflect.ValueOf(&n))
+	}
+	return nil
+}
+
+// setFrom sets the setting key and records its source.
+func (c *Config) setFrom(key, value, source string) error {
+	if err := c.Set(key, value); err != nil {
+		return err
+	}
+	c.Sources[key] = source
+	return nil
+}
+
+// field returns the settable struct field of the setting key.
+func (c *Config) field(key string) (reflect.Value, bool) {
+	var index []int
+	walkFields(reflect.TypeOf(*c), "", func(k string, i []int) {
+		if k == key {
+			index = i
+		}
+	})
+	if index == nil {
+		return reflect.Value{}, false
+	}
+	return reflect.ValueOf(c).Elem().FieldByIndex(index), true
+}
+
+// walkFields calls fn with the key and field index of every setting of the
+// struct type t, descending into nested structs. Fields without a YAML key
+// are skipped, the settings of inlined structs belong to the parent.
+func walkFields(t reflect.Type, prefix string, fn func(key string, index []int)) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "" && options == "inline" && field.Type.Kind() == reflect.Struct {
+			walkFields(field.Type, prefix, func(k string, index []int) {
+				fn(k, append([]int{i}, index...))
+			})
+			continue
+		}
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + name
+		if field.Type.Kind() == reflect.Struct {
+			walkFields(field.Type, key+".", func(k string, index []int) {
+				fn(k, append([]int{i}, index...))
+			})
+			continue
+		}
+		fn(key, []int{i})
+	}
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectFile is the name of the project file, kept in a repository or one
+// of its parent directories.
+const ProjectFile = ".gitea-sync.yaml"
+
+// Project holds the defaults of the repositories below the directory of a
+// project file. They take precedence over the config file, but not over
+// environment variables and flags.
+type Project struct {
+	// Path is the project file, or "" if none was found.
+	Path string `yaml:"-"`
+	// Name is the repository name used by add instead of the directory
+	// name.
+	Name string `yaml:"name,omitempty"`
+	// Visibility is "public" or "private". Empty leaves the choice to the
+	// --private flag.
+	Visibility string `yaml:"visibility,omitempty"`
+	// Targets lists the mirror targets used when no --target flag is given.
+	Targets []string `yaml:"targets,omitempty"`
+	// Owner is the Gitea organization owning the repositories, see
+	// GiteaConfig.Owner.
+	Owner string `yaml:"owner,omitempty"`
+}
+
+// projectKeys are the keys of a project file.
+var projectKeys = []string{"name", "visibility", "targets", "owner"}
+
+// FindProject reads the nearest project file in dir or one of its parent
+// directories. It returns an empty Project if there is none. The config
+// file is never read as a project file, even in its old location
+// ~/.gitea-sync.yaml.
+func FindProject(dir string) (*Project, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	var skip []string
+	if path, err := ConfigPath(); err == nil {
+		skip = append(skip, path)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		skip = append(skip, legacyConfigPath(home))
+	}
+
+	for {
+		path := filepath.Join(dir, ProjectFile)
+		if !sameFile(path, skip) {
+			data, err := os.ReadFile(path)
+			if err == nil {
+				return readProject(path, data)
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return &Project{}, nil
+		}
+		dir = parent
+	}
+}
+
+// sameFile reports whether path is one of the files in paths.
+func sameFile(path string, paths []string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	for _, p := range paths {
+		if other, err := os.Stat(p); err == nil && os.SameFile(info, other) {
+			return true
+		}
+	}
+	return false
+}
+
+// readProject parses the project file at path with the content data.
+func readProject(path string, data []byte) (*Project, error) {
+	p := &Project{Path: path}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse project file %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return p, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("failed to parse project file: %s is not a mapping", path)
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if key := root.Content[i]; !slices.Contains(projectKeys, key.Value) {
+			return nil, fmt.Errorf("failed to parse project file %s: %w", path, unknownKeyError(key, key.Value, projectKeys))
+		}
+	}
+	if err := doc.Decode(p); err != nil {
+		return nil, fmt.Errorf("failed to parse project file %s: %w", path, err)
+	}
+	switch p.Visibility {
+	case "", "public", "private":
+	default:
+		return nil, fmt.Errorf("%s: visibility must be \"public\" or \"private\", got %q", path, p.Visibility)
+	}
+	return p, nil
+}
+
+// Private reports whether new repositories are private, given the value
+// of the --private flag and whether it was set.
+func (p *Project) Private(flag, flagSet bool) bool {
+	if flagSet || p.Visibility == "" {
+		return flag
+	}
+	return p.Visibility == "private"
+}
+
+// Apply merges the settings of the project into cfg, unless they are set
+// in the environment or with a flag.
+func (p *Project) Apply(cfg *Config) {
+	p.apply(cfg, "targets", strings.Join(p.Targets, ","))
+	p.apply(cfg, "gitea.owner", p.Owner)
+}
+
+// apply sets the setting key to value unless value is empty or the setting
+// comes from the environment or a flag.
+func (p *Project) apply(cfg *Config, key, value string) {
+	if value == "" {
+		return
+	}
+	if source := cfg.Sources[key]; source == "" || source == SourceFile {
+		cfg.Set(key, value)
+		cfg.Sources[key] = SourceProject + " " + p.Path
+	}
+}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the version of the config file layout written by this
+// build. Files without a version key are version 0.
+const CurrentVersion = 1
+
+// migration upgrades the config file from version to-1 to version to. It
+// edits the YAML tree in place, so that comments are kept.
+type migration struct {
+	to    int
+	apply func(root *yaml.Node) error
+}
+
+// migrations upgrade old config files, in order. When the layout of the
+// file changes, append a migration and raise CurrentVersion. The keys are
+// checked after migrating, so a migration may rename keys freely.
+var migrations = []migration{
+	// Files written before the version key have the layout of version 1
+	{to: 1, apply: func(root *yaml.Node) error { return nil }},
+}
+
+// OnMigrate, if set, is called after the config file at path has been
+// upgraded from version from to CurrentVersion. backup is the copy of the
+// old file.
+var OnMigrate func(path, backup string, from int)
+
+// fileVersion returns the version of the config file with the root
+// mapping root.
+func fileVersion(root *yaml.Node) (int, error) {
+	node := lookupKey(root, "version")
+	if node == nil {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(node.Value)
+	if err != nil || node.Kind != yaml.ScalarNode || version < 0 {
+		return 0, fmt.Errorf("line %d: version must be a number, got %q", node.Line, node.Value)
+	}
+	if version > CurrentVersion {
+		return 0, fmt.Errorf("config version %d is newer than this gitea-sync supports (%d). Upgrade gitea-sync", version, CurrentVersion)
+	}
+	return version, nil
+}
+
+// migrate upgrades the config file at path, parsed from data into doc, to
+// CurrentVersion. The old file is first copied to path.v<version>.bak.
+func migrate(path string, data []byte, doc *yaml.Node) error {
+	root := doc.Content[0]
+	from, err := fileVersion(root)
+	if err != nil || from == CurrentVersion {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.to <= from {
+			continue
+		}
+		if err := m.apply(root); err != nil {
+			return fmt.Errorf("failed to upgrade config to version %d: %w", m.to, err)
+		}
+	}
+	setVersion(root)
+
+	backup := fmt.Sprintf("%s.v%d.bak", path, from)
+	if err := os.WriteFile(backup, data, 0600); err != nil {
+		return fmt.Errorf("failed to back up config before upgrading it: %w", err)
+	}
+	upgraded, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, upgraded, 0600); err != nil {
+		return fmt.Errorf("failed to write upgraded config: %w", err)
+	}
+	if OnMigrate != nil {
+		OnMigrate(path, backup, from)
+	}
+	return nil
+}
+
+// setVersion sets the version key of the root mapping to CurrentVersion,
+// adding it as the first key if it is missing.
+func setVersion(root *yaml.Node) {
+	value := &yaml.Node{Kind: yaml.ScalarNode, Value: strconv.Itoa(CurrentVersion)}
+	if lookupKey(root, "version") != nil {
+		setKey(root, "version", value)
+		return
+	}
+	key := &yaml.Node{Kind: yaml.ScalarNode, Value: "version"}
+	// Keep a comment at the top of the file above the new key
+	if len(root.Content) > 0 {
+		key.HeadComment, root.Content[0].HeadComment = root.Content[0].HeadComment, ""
+	}
+	root.Content = append([]*yaml.Node{key, value}, root.Content...)
+}
+
+// fileKeys are the keys of the config file besides the settings of the
+// default profile.
+var fileKeys = []string{"version", "default_profile", "profiles"}
+
+// checkKeys rejects keys of the config file with the root mapping root
+// that are no setting, e.g. misspelled ones, which yaml.Unmarshal would
+// silently ignore.
+func checkKeys(root *yaml.Node) error {
+	if err := checkSettingKeys(root, "", fileKeys); err != nil {
+		return err
+	}
+	profiles := lookupKey(root, "profiles")
+	if profiles == nil {
+		return nil
+	}
+	if profiles.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: profiles must map profile names to settings", profiles.Line)
+	}
+	for i := 0; i+1 < len(profiles.Content); i += 2 {
+		name, settings := profiles.Content[i], profiles.Content[i+1]
+		if settings.Kind != yaml.MappingNode {
+			return fmt.Errorf("line %d: profile %q must be a mapping of settings", settings.Line, name.Value)
+		}
+		if err := checkSettingKeys(settings, "profiles."+name.Value+".", nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSettingKeys rejects keys of the settings mapping m that are no
+// setting, other than the keys in extra. prefix is the path of m in the
+// file, e.g. "profiles.work.".
+func checkSettingKeys(m *yaml.Node, prefix string, extra []string) error {
+	valid := append(slices.Clone(extra), subKeys("")...)
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		key, value := m.Content[i], m.Content[i+1]
+		if !slices.Contains(valid, key.Value) {
+			return unknownKeyError(key, prefix+key.Value, valid)
+		}
+		section := subKeys(key.Value + ".")
+		if len(section) == 0 || value.Kind != yaml.MappingNode {
+			continue
+		}
+		for j := 0; j+1 < len(value.Content); j += 2 {
+			if sub := value.Content[j]; !slices.Contains(section, sub.Value) {
+				return unknownKeyError(sub, prefix+key.Value+"."+sub.Value, section)
+			}
+		}
+	}
+	return nil
+}
+
+// subKeys returns the keys below prefix, e.g. "url" and "token" for
+// "gitea.", or the sections and top-level settings for "".
+func subKeys(prefix string) []string {
+	var keys []string
+	for _, key := range Keys() {
+		rest, ok := strings.CutPrefix(key, prefix)
+		if !ok {
+			continue
+		}
+		if prefix == "" {
+			rest, _, _ = strings.Cut(rest, ".")
+		}
+		if !slices.Contains(keys, rest) {
+			keys = append(keys, rest)
+		}
+	}
+	return keys
+}
+
+func unknownKeyError(key *yaml.Node, path string, valid []string) error {
+	return fmt.Errorf("line %d: unknown key %q (valid keys here: %s)", key.Line, path, strings.Join(valid, ", "))
+}
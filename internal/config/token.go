@@ -0,0 +1,134 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/Papiermond/gitea-sync/internal/keyring"
+)
+
+// TokenConfig is where the token of a forge comes from. At most one of the
+// fields is set. Tokens from a command, a file or the keyring are only read
+// when a client of the forge is created, see Resolve.
+type TokenConfig struct {
+	// Token is the token itself, stored in plain text.
+	Token string `yaml:"token,omitempty"`
+	// TokenCmd is a shell command printing the token on its first line of
+	// output, e.g. "pass show gitea".
+	TokenCmd string `yaml:"token_cmd,omitempty"`
+	// TokenFile is a file holding the token, e.g. a Docker secret.
+	TokenFile string `yaml:"token_file,omitempty"`
+	// TokenKeyring is the account of the token in the Secret Service, see
+	// package keyring.
+	TokenKeyring string `yaml:"token_keyring,omitempty"`
+
+	// resolved caches the token read by Resolve.
+	resolved *string
+}
+
+// TokenKeys are the keys of the fields of TokenConfig within a section.
+var TokenKeys = []string{"token", "token_cmd", "token_file", "token_keyring"}
+
+// IsSet reports whether any token source is configured.
+func (t *TokenConfig) IsSet() bool {
+	return t.Token != "" || t.TokenCmd != "" || t.TokenFile != "" || t.TokenKeyring != ""
+}
+
+// Resolve returns the token, running the token command, reading the token
+// file or looking it up in the keyring as configured. The result is
+// cached. It returns "" if no token is configured. section names the config
+// section in errors, e.g. "gitlab".
+func (t *TokenConfig) Resolve(section string) (string, error) {
+	if t.resolved != nil {
+		return *t.resolved, nil
+	}
+
+	var token string
+	switch {
+	case t.Token != "":
+		token = t.Token
+	case t.TokenCmd != "":
+		cmd := exec.Command("sh", "-c", t.TokenCmd)
+		// The command may ask for a passphrase, e.g. through gpg-agent
+		cmd.Stderr = os.Stderr
+		output, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("%s.token_cmd: %q failed: %w", section, t.TokenCmd, err)
+		}
+		line, _, _ := bytes.Cut(output, []byte("\n"))
+		if token = strings.TrimSpace(string(line)); token == "" {
+			return "", fmt.Errorf("%s.token_cmd: %q printed no token", section, t.TokenCmd)
+		}
+	case t.TokenFile != "":
+		data, err := os.ReadFile(t.TokenFile)
+		if err != nil {
+			return "", fmt.Errorf("%s.token_file: %w", section, err)
+		}
+		if token = strings.TrimSpace(string(data)); token == "" {
+			return "", fmt.Errorf("%s.token_file: %s is empty", section, t.TokenFile)
+		}
+	case t.TokenKeyring != "":
+		var err error
+		token, err = keyring.Get(t.TokenKeyring)
+		if errors.Is(err, keyring.ErrNotFound) {
+			return "", fmt.Errorf("%s.token_keyring: no token stored for %q. Run 'gitea-sync init' to store it", section, t.TokenKeyring)
+		}
+		if err != nil {
+			return "", fmt.Errorf("%s.token_keyring: %w", section, err)
+		}
+	}
+	t.resolved = &token
+	return token, nil
+}
+
+// KeyringAccount returns the keyring account of the token of section in
+// the named profile, e.g. "work/gitlab".
+func KeyringAccount(profile, section string) string {
+	return profile + "/" + section
+}
+
+// tokenSections returns the config sections holding a token, e.g. "gitea".
+func tokenSections() []string {
+	var sections []string
+	for _, key := range Keys() {
+		if section, ok := strings.CutSuffix(key, ".token"); ok {
+			sections = append(sections, section)
+		}
+	}
+	return sections
+}
+
+// overrideTokenSources lets a token source given in the environment or as
+// a flag replace the token sources of the config file, and checks that
+// each section has at most one token source.
+func (c *Config) overrideTokenSources() error {
+	for _, section := range tokenSections() {
+		overridden := false
+		for _, key := range TokenKeys {
+			source, ok := c.Sources[section+"."+key]
+			if ok && source != SourceFile {
+				overridden = true
+			}
+		}
+
+		var set []string
+		for _, key := range TokenKeys {
+			key = section + "." + key
+			if overridden && c.Sources[key] == SourceFile {
+				c.Set(key, "")
+				delete(c.Sources, key)
+			}
+			if c.Get(key) != "" {
+				set = append(set, key)
+			}
+		}
+		if len(set) > 1 {
+			return fmt.Errorf("%s: set only one of %s", section, strings.Join(set, ", "))
+		}
+	}
+	return nil
+}
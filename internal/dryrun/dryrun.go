@@ -0,0 +1,103 @@
+package dryrun
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Transport performs read-only requests (GET, HEAD, OPTIONS) and reports
+// every other request instead of sending it, answering with the success
+// status the APIs use for that kind of write.
+type Transport struct {
+	// Base performs the read-only requests. Nil means http.DefaultTransport.
+	Base http.RoundTripper
+	// OnWrite is called with every write that is not sent and its payload,
+	// redacted by Redact.
+	OnWrite func(req *http.Request, payload string)
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS":
+		base := t.Base
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		return base.RoundTrip(req)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if t.OnWrite != nil {
+		t.OnWrite(req, Redact(body))
+	}
+
+	status := successStatus(req)
+	return &http.Response{
+		Status:     http.StatusText(status),
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader("{}")),
+		Request:    req,
+	}, nil
+}
+
+// successStatus returns the status a successful write is answered with:
+// 201 for created resources, 200 for updates and triggered actions such as
+// Gitea's push_mirrors-sync, and 204 for replaced or deleted resources.
+func successStatus(req *http.Request) int {
+	switch req.Method {
+	case "POST":
+		if strings.HasSuffix(req.URL.Path, "-sync") {
+			return http.StatusOK
+		}
+		return http.StatusCreated
+	case "PATCH":
+		return http.StatusOK
+	default:
+		return http.StatusNoContent
+	}
+}
+
+// Redact returns a JSON payload with the values of secret fields (tokens
+// and passwords) replaced. Payloads that are not JSON objects are returned
+// unchanged.
+func Redact(body []byte) string {
+	var fields map[string]any
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return string(bytes.TrimSpace(body))
+	}
+	for key, value := range fields {
+		if value != "" && isSecret(key) {
+			fields[key] = "REDACTED"
+		}
+	}
+	redacted, err := json.Marshal(fields)
+	if err != nil {
+		return ""
+	}
+	return string(redacted)
+}
+
+func isSecret(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range []string{"token", "password", "secret"} {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
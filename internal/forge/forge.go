@@ -0,0 +1,137 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Papiermond/gitea-sync/internal/config"
+)
+
+// CreateRepoOptions describes a repository to create on a mirror target. It
+// is created in the account returned by Provider.Owner.
+type CreateRepoOptions struct {
+	Name        string
+	Description string
+	Private     bool
+}
+
+// Provider is a forge that Gitea can push-mirror repositories to.
+type Provider interface {
+	// Name returns the registry key of the provider, e.g. "github".
+	Name() string
+	// DisplayName returns the human readable platform name, e.g. "GitHub".
+	DisplayName() string
+	RepoExists(ctx context.Context, owner, repo string) (bool, error)
+	CreateRepo(ctx context.Context, opts CreateRepoOptions) error
+	// DeleteRepo deletes a repository, e.g. to undo CreateRepo.
+	DeleteRepo(ctx context.Context, owner, repo string) error
+	// CloneURL returns the HTTPS clone URL that Gitea pushes the mirror to.
+	CloneURL(owner, repo string) string
+	// WebURL returns the browser URL of the repository.
+	WebURL(owner, repo string) string
+	// Credentials returns the username and token Gitea uses for the push mirror.
+	Credentials() (username, token string)
+	// Owner returns the account the repositories are created in and pushed
+	// to: an organization or group if one is configured, else the user of
+	// Credentials.
+	Owner() string
+}
+
+// RemoteRepo is a repository listed on a forge.
+type RemoteRepo struct {
+	Name        string
+	Description string
+	Private     bool
+	Fork        bool
+	Archived    bool
+	// CloneURL is the HTTPS clone URL of the repository.
+	CloneURL string
+}
+
+// Lister is implemented by providers that can list the repositories of an
+// account, e.g. to import them into Gitea.
+type Lister interface {
+	// ListRepos returns every repository owned by a user, or by an
+	// organization (group on GitLab) when org is true.
+	ListRepos(ctx context.Context, owner string, org bool) ([]RemoteRepo, error)
+}
+
+// EditRepoOptions changes the settings of a repository on a mirror target.
+// Nil fields are left unchanged.
+type EditRepoOptions struct {
+	Description *string
+	Private     *bool
+}
+
+// Editor is implemented by providers that can read and change the settings
+// of a repository, e.g. for plan and apply.
+type Editor interface {
+	// GetRepo returns the repository. CloneURL, Fork and Archived may be
+	// left empty.
+	GetRepo(ctx context.Context, owner, repo string) (*RemoteRepo, error)
+	EditRepo(ctx context.Context, owner, repo string, opts EditRepoOptions) error
+}
+
+// Account is the user a provider's token authenticates as.
+type Account struct {
+	Username string
+	// Scopes are the scopes granted to the token, or nil if the platform
+	// does not report them, e.g. for GitHub fine-grained tokens.
+	Scopes []string
+	// Missing lists the scopes mirroring needs that the token lacks.
+	Missing []string
+	// MissingOptional maps scopes the token lacks to the optional feature
+	// that needs them, e.g. "delete_repo" to "--rollback".
+	MissingOptional map[string]string
+	// Expires is when the token expires, or zero if it never does or the
+	// platform does not report it.
+	Expires time.Time
+}
+
+// Verifier is implemented by providers that can check their token, e.g.
+// for the doctor command.
+type Verifier interface {
+	// Account returns the account and scopes of the token.
+	Account(ctx context.Context) (*Account, error)
+	// TokenURL returns the page where the user creates tokens.
+	TokenURL() string
+}
+
+// Factory builds a provider from the loaded configuration. The provider
+// sends its API requests through httpClient.
+type Factory func(cfg *config.Config, httpClient *http.Client) (Provider, error)
+
+var registry = map[string]Factory{}
+
+// Register makes a provider available under name. It is meant to be called
+// from the init function of the package implementing the provider.
+func Register(name string, factory Factory) {
+	name = strings.ToLower(name)
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("forge: provider %q registered twice", name))
+	}
+	registry[name] = factory
+}
+
+// New returns the provider registered under name.
+func New(name string, cfg *config.Config, httpClient *http.Client) (Provider, error) {
+	factory, ok := registry[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown target %q (available: %s)", name, strings.Join(Names(), ", "))
+	}
+	return factory(cfg, httpClient)
+}
+
+// Names returns the names of all registered providers in sorted order.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -2,12 +2,19 @@ package gitea
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Papiermond/gitea-sync/internal/apierror"
 )
 
+// platform names the forge in API errors.
+const platform = "Gitea"
+
 type Client struct {
 	baseURL string
 	token   string
@@ -15,9 +22,17 @@ type Client struct {
 }
 
 type CreateRepoRequest struct {
-	Name     string `json:"name"`
-	Private  bool   `json:"private"`
-	AutoInit bool   `json:"auto_init"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Private     bool   `json:"private"`
+	AutoInit    bool   `json:"auto_init"`
+}
+
+// EditRepoRequest changes the settings of a repository. Nil fields are left
+// unchanged.
+type EditRepoRequest struct {
+	Description *string `json:"description,omitempty"`
+	Private     *bool   `json:"private,omitempty"`
 }
 
 type PushMirrorRequest struct {
@@ -28,17 +43,70 @@ type PushMirrorRequest struct {
 	Interval       string `json:"interval"`
 }
 
-func NewClient(baseURL, token string) *Client {
+// MigrateRepoRequest imports a repository from another forge. With Mirror
+// set, Gitea keeps pulling from CloneAddr every MirrorInterval.
+type MigrateRepoRequest struct {
+	CloneAddr      string `json:"clone_addr"`
+	RepoName       string `json:"repo_name"`
+	RepoOwner      string `json:"repo_owner,omitempty"`
+	Service        string `json:"service"` // "git", "github", "gitlab", ...
+	AuthUsername   string `json:"auth_username,omitempty"`
+	AuthToken      string `json:"auth_token,omitempty"`
+	Mirror         bool   `json:"mirror"`
+	MirrorInterval string `json:"mirror_interval,omitempty"`
+	Private        bool   `json:"private"`
+	Description    string `json:"description,omitempty"`
+}
+
+type User struct {
+	Login string `json:"login"`
+}
+
+// OrgPermissions are the permissions of a user in an organization.
+type OrgPermissions struct {
+	IsOwner             bool `json:"is_owner"`
+	IsAdmin             bool `json:"is_admin"`
+	CanWrite            bool `json:"can_write"`
+	CanRead             bool `json:"can_read"`
+	CanCreateRepository bool `json:"can_create_repository"`
+}
+
+type Repository struct {
+	Name        string `json:"name"`
+	FullName    string `json:"full_name"`
+	Owner       User   `json:"owner"`
+	Description string `json:"description"`
+	Private     bool   `json:"private"`
+	HTMLURL     string `json:"html_url"`
+}
+
+type PushMirror struct {
+	RepoName      string     `json:"repo_name"`
+	RemoteName    string     `json:"remote_name"`
+	RemoteAddress string     `json:"remote_address"`
+	Created       time.Time  `json:"created"`
+	LastUpdate    *time.Time `json:"last_update"`
+	LastError     string     `json:"last_error"`
+	Interval      string     `json:"interval"`
+	SyncOnCommit  bool       `json:"sync_on_commit"`
+}
+
+// NewClient returns a client for the Gitea instance at baseURL. A nil
+// httpClient uses a default client.
+func NewClient(baseURL, token string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
 	return &Client{
-		baseURL: baseURL,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
 		token:   token,
-		client:  &http.Client{},
+		client:  httpClient,
 	}
 }
 
-func (c *Client) RepoExists(username, repo string) (bool, error) {
+func (c *Client) RepoExists(ctx context.Context, username, repo string) (bool, error) {
 	url := fmt.Sprintf("%s/api/v1/repos/%s/%s", c.baseURL, username, repo)
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return false, err
 	}
@@ -57,18 +125,26 @@ func (c *Client) RepoExists(username, repo string) (bool, error) {
 		return true, nil
 	}
 
-	body, _ := io.ReadAll(resp.Body)
-	return false, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, body)
+	return false, apierror.New(platform, "check repo", resp)
 }
 
-func (c *Client) CreateRepo(req CreateRepoRequest) error {
-	url := fmt.Sprintf("%s/api/v1/user/repos", c.baseURL)
+// CreateRepo creates a repository owned by the user of the token.
+func (c *Client) CreateRepo(ctx context.Context, req CreateRepoRequest) error {
+	return c.createRepo(ctx, fmt.Sprintf("%s/api/v1/user/repos", c.baseURL), req)
+}
+
+// CreateOrgRepo creates a repository owned by the organization org.
+func (c *Client) CreateOrgRepo(ctx context.Context, org string, req CreateRepoRequest) error {
+	return c.createRepo(ctx, fmt.Sprintf("%s/api/v1/orgs/%s/repos", c.baseURL, org), req)
+}
+
+func (c *Client) createRepo(ctx context.Context, url string, req CreateRepoRequest) error {
 	body, err := json.Marshal(req)
 	if err != nil {
 		return err
 	}
 
-	httpReq, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
 	if err != nil {
 		return err
 	}
@@ -82,21 +158,180 @@ func (c *Client) CreateRepo(req CreateRepoRequest) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 201 {
-		respBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to create repo (status %d): %s", resp.StatusCode, respBody)
+		return apierror.New(platform, "create repo", resp)
 	}
 
 	return nil
 }
 
-func (c *Client) AddPushMirror(username, repo string, req PushMirrorRequest) error {
+// Migrate creates a repository by importing it from another forge.
+func (c *Client) Migrate(ctx context.Context, req MigrateRepoRequest) error {
+	url := fmt.Sprintf("%s/api/v1/repos/migrate", c.baseURL)
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Authorization", "token "+c.token)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 201 {
+		return apierror.New(platform, "migrate repo", resp)
+	}
+
+	return nil
+}
+
+// DeleteRepo deletes a repository together with its push mirrors.
+func (c *Client) DeleteRepo(ctx context.Context, username, repo string) error {
+	url := fmt.Sprintf("%s/api/v1/repos/%s/%s", c.baseURL, username, repo)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "token "+c.token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 204 {
+		return apierror.New(platform, "delete repo", resp)
+	}
+
+	return nil
+}
+
+func (c *Client) GetRepo(ctx context.Context, username, repo string) (*Repository, error) {
+	url := fmt.Sprintf("%s/api/v1/repos/%s/%s", c.baseURL, username, repo)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "token "+c.token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, apierror.New(platform, "get repo", resp)
+	}
+
+	var repository Repository
+	if err := json.NewDecoder(resp.Body).Decode(&repository); err != nil {
+		return nil, fmt.Errorf("failed to decode repo: %w", err)
+	}
+	return &repository, nil
+}
+
+func (c *Client) EditRepo(ctx context.Context, username, repo string, req EditRepoRequest) error {
+	url := fmt.Sprintf("%s/api/v1/repos/%s/%s", c.baseURL, username, repo)
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "PATCH", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Authorization", "token "+c.token)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return apierror.New(platform, "edit repo", resp)
+	}
+
+	return nil
+}
+
+func (c *Client) GetTopics(ctx context.Context, username, repo string) ([]string, error) {
+	url := fmt.Sprintf("%s/api/v1/repos/%s/%s/topics", c.baseURL, username, repo)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "token "+c.token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, apierror.New(platform, "get topics", resp)
+	}
+
+	var topics struct {
+		Topics []string `json:"topics"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&topics); err != nil {
+		return nil, fmt.Errorf("failed to decode topics: %w", err)
+	}
+	return topics.Topics, nil
+}
+
+// SetTopics replaces all topics of a repository.
+func (c *Client) SetTopics(ctx context.Context, username, repo string, topics []string) error {
+	url := fmt.Sprintf("%s/api/v1/repos/%s/%s/topics", c.baseURL, username, repo)
+	if topics == nil {
+		topics = []string{}
+	}
+	body, err := json.Marshal(map[string][]string{"topics": topics})
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "PUT", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Authorization", "token "+c.token)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 204 {
+		return apierror.New(platform, "set topics", resp)
+	}
+
+	return nil
+}
+
+func (c *Client) AddPushMirror(ctx context.Context, username, repo string, req PushMirrorRequest) error {
 	url := fmt.Sprintf("%s/api/v1/repos/%s/%s/push_mirrors", c.baseURL, username, repo)
 	body, err := json.Marshal(req)
 	if err != nil {
 		return err
 	}
 
-	httpReq, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
 	if err != nil {
 		return err
 	}
@@ -110,13 +345,301 @@ func (c *Client) AddPushMirror(username, repo string, req PushMirrorRequest) err
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 201 && resp.StatusCode != 200 {
-		respBody, _ := io.ReadAll(resp.Body)
-		// Mirror might already exist, check response
-		if bytes.Contains(respBody, []byte("already exists")) {
-			return nil // Not an error
+		err := apierror.New(platform, "add mirror", resp)
+		// Mirror might already exist, make sure it points where we expect
+		if apierror.IsConflict(err) {
+			mirrors, err := c.ListPushMirrors(ctx, username, repo)
+			if err != nil {
+				return err
+			}
+			if _, ok := FindPushMirror(mirrors, req.RemoteAddress); ok {
+				return nil // Not an error
+			}
+			return fmt.Errorf("a push mirror already exists but none points to %s", req.RemoteAddress)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// ListRepos returns every repository the authenticated user has access to.
+func (c *Client) ListRepos(ctx context.Context) ([]Repository, error) {
+	const limit = 50
+	var repos []Repository
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("%s/api/v1/user/repos?page=%d&limit=%d", c.baseURL, page, limit)
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "token "+c.token)
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != 200 {
+			err := apierror.New(platform, "list repos", resp)
+			resp.Body.Close()
+			return nil, err
+		}
+
+		var batch []Repository
+		err = json.NewDecoder(resp.Body).Decode(&batch)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode repos: %w", err)
+		}
+
+		repos = append(repos, batch...)
+		if len(batch) < limit {
+			return repos, nil
 		}
-		return fmt.Errorf("failed to add mirror (status %d): %s", resp.StatusCode, respBody)
+	}
+}
+
+func (c *Client) ListPushMirrors(ctx context.Context, username, repo string) ([]PushMirror, error) {
+	url := fmt.Sprintf("%s/api/v1/repos/%s/%s/push_mirrors", c.baseURL, username, repo)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "token "+c.token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, apierror.New(platform, "list push mirrors", resp)
+	}
+
+	var mirrors []PushMirror
+	if err := json.NewDecoder(resp.Body).Decode(&mirrors); err != nil {
+		return nil, fmt.Errorf("failed to decode push mirrors: %w", err)
+	}
+	return mirrors, nil
+}
+
+func (c *Client) GetPushMirror(ctx context.Context, username, repo, name string) (*PushMirror, error) {
+	url := fmt.Sprintf("%s/api/v1/repos/%s/%s/push_mirrors/%s", c.baseURL, username, repo, name)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "token "+c.token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, apierror.New(platform, "get push mirror", resp)
+	}
+
+	var mirror PushMirror
+	if err := json.NewDecoder(resp.Body).Decode(&mirror); err != nil {
+		return nil, fmt.Errorf("failed to decode push mirror: %w", err)
+	}
+	return &mirror, nil
+}
+
+func (c *Client) DeletePushMirror(ctx context.Context, username, repo, name string) error {
+	url := fmt.Sprintf("%s/api/v1/repos/%s/%s/push_mirrors/%s", c.baseURL, username, repo, name)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "token "+c.token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 204 {
+		return apierror.New(platform, "delete push mirror", resp)
 	}
 
 	return nil
 }
+
+// SyncPushMirrors triggers an immediate sync of all push mirrors of a repository.
+func (c *Client) SyncPushMirrors(ctx context.Context, username, repo string) error {
+	url := fmt.Sprintf("%s/api/v1/repos/%s/%s/push_mirrors-sync", c.baseURL, username, repo)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "token "+c.token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return apierror.New(platform, "sync push mirrors", resp)
+	}
+
+	return nil
+}
+
+// Version returns the version of the Gitea server. The endpoint needs no
+// token, so it also tells whether the server is reachable at all.
+func (c *Client) Version(ctx context.Context) (string, error) {
+	url := fmt.Sprintf("%s/api/v1/version", c.baseURL)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", apierror.New(platform, "get version", resp)
+	}
+
+	var version struct {
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&version); err != nil {
+		return "", fmt.Errorf("failed to decode version: %w", err)
+	}
+	return version.Version, nil
+}
+
+// CurrentUser returns the user the token authenticates as.
+func (c *Client) CurrentUser(ctx context.Context) (*User, error) {
+	url := fmt.Sprintf("%s/api/v1/user", c.baseURL)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "token "+c.token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, apierror.New(platform, "get user", resp)
+	}
+
+	var user User
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return nil, fmt.Errorf("failed to decode user: %w", err)
+	}
+	return &user, nil
+}
+
+// OrgPermissions returns the permissions of username in the organization
+// org. Gitea answers 404 if the organization does not exist or username
+// cannot see it.
+func (c *Client) OrgPermissions(ctx context.Context, username, org string) (*OrgPermissions, error) {
+	url := fmt.Sprintf("%s/api/v1/users/%s/orgs/%s/permissions", c.baseURL, username, org)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "token "+c.token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, apierror.New(platform, "get organization permissions", resp)
+	}
+
+	var permissions OrgPermissions
+	if err := json.NewDecoder(resp.Body).Decode(&permissions); err != nil {
+		return nil, fmt.Errorf("failed to decode organization permissions: %w", err)
+	}
+	return &permissions, nil
+}
+
+// CheckRepoScope checks that the token may create repositories, which
+// needs the write:repository scope on Gitea 1.19 and later. Gitea does not
+// report the scopes of the token in use, so this sends a repository
+// creation without a name: Gitea checks the scopes before validating the
+// request and answers 403 without the scope and 422 with it, creating
+// nothing either way. As it is still a write request, doctor only sends it
+// with --probe-scopes.
+func (c *Client) CheckRepoScope(ctx context.Context) error {
+	url := fmt.Sprintf("%s/api/v1/user/repos", c.baseURL)
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader("{}"))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Authorization", "token "+c.token)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 422 {
+		return apierror.New(platform, "check token scopes", resp)
+	}
+
+	return nil
+}
+
+// FindPushMirror returns the mirror that pushes to address, if any.
+func FindPushMirror(mirrors []PushMirror, address string) (PushMirror, bool) {
+	for _, mirror := range mirrors {
+		if mirror.PushesTo(address) {
+			return mirror, true
+		}
+	}
+	return PushMirror{}, false
+}
+
+// PushesTo reports whether the mirror pushes to address. A trailing slash or
+// ".git" suffix and the letter case are ignored.
+func (m PushMirror) PushesTo(address string) bool {
+	return strings.EqualFold(normalizeRemote(m.RemoteAddress), normalizeRemote(address))
+}
+
+// Matches reports whether the mirror has the remote address, interval and
+// sync-on-commit setting requested by req.
+func (m PushMirror) Matches(req PushMirrorRequest) bool {
+	return m.PushesTo(req.RemoteAddress) &&
+		m.SyncOnCommit == req.SyncOnCommit &&
+		sameInterval(m.Interval, req.Interval)
+}
+
+func normalizeRemote(address string) string {
+	address = strings.TrimSuffix(strings.TrimSpace(address), "/")
+	return strings.TrimSuffix(address, ".git")
+}
+
+// sameInterval compares Gitea intervals, which come back as "8h0m0s" for a
+// requested "8h".
+func sameInterval(a, b string) bool {
+	da, errA := time.ParseDuration(a)
+	db, errB := time.ParseDuration(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return da == db
+}
@@ -2,33 +2,95 @@ package github
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Papiermond/gitea-sync/internal/apierror"
+	"github.com/Papiermond/gitea-sync/internal/config"
+	"github.com/Papiermond/gitea-sync/internal/forge"
 )
 
+// platform names the forge in API errors.
+const platform = "GitHub"
+
 type Client struct {
-	token  string
+	token    string
+	username string
+	// owner is the organization the repositories are created in, or "" for
+	// the user's own account.
+	owner  string
 	client *http.Client
 }
 
 type CreateRepoRequest struct {
-	Name     string `json:"name"`
-	Private  bool   `json:"private"`
-	AutoInit bool   `json:"auto_init"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Private     bool   `json:"private"`
+	AutoInit    bool   `json:"auto_init"`
+}
+
+func init() {
+	forge.Register("github", func(cfg *config.Config, httpClient *http.Client) (forge.Provider, error) {
+		if !cfg.GitHub.IsSet() || cfg.GitHub.Username == "" {
+			return nil, fmt.Errorf("GitHub credentials not configured. Run 'gitea-sync init' to configure")
+		}
+		token, err := cfg.GitHub.Resolve("github")
+		if err != nil {
+			return nil, err
+		}
+		client := NewClient(token, cfg.GitHub.Username, httpClient)
+		client.owner = cfg.GitHub.Owner
+		return client, nil
+	})
 }
 
-func NewClient(token string) *Client {
+// NewClient returns a GitHub client. A nil httpClient uses a default client.
+func NewClient(token, username string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
 	return &Client{
-		token:  token,
-		client: &http.Client{},
+		token:    token,
+		username: username,
+		client:   httpClient,
+	}
+}
+
+func (c *Client) Name() string {
+	return "github"
+}
+
+func (c *Client) DisplayName() string {
+	return "GitHub"
+}
+
+func (c *Client) CloneURL(owner, repo string) string {
+	return fmt.Sprintf("https://github.com/%s/%s.git", owner, repo)
+}
+
+func (c *Client) WebURL(owner, repo string) string {
+	return fmt.Sprintf("https://github.com/%s/%s", owner, repo)
+}
+
+func (c *Client) Credentials() (username, token string) {
+	return c.username, c.token
+}
+
+func (c *Client) Owner() string {
+	if c.owner != "" {
+		return c.owner
 	}
+	return c.username
 }
 
-func (c *Client) RepoExists(username, repo string) (bool, error) {
+func (c *Client) RepoExists(ctx context.Context, username, repo string) (bool, error) {
 	url := fmt.Sprintf("https://api.github.com/repos/%s/%s", username, repo)
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return false, err
 	}
@@ -47,18 +109,27 @@ func (c *Client) RepoExists(username, repo string) (bool, error) {
 		return true, nil
 	}
 
-	body, _ := io.ReadAll(resp.Body)
-	return false, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, body)
+	return false, apierror.New(platform, "check repo", resp)
 }
 
-func (c *Client) CreateRepo(req CreateRepoRequest) error {
+// CreateRepo creates a repository in the configured organization, or in the
+// user's account if there is none.
+func (c *Client) CreateRepo(ctx context.Context, opts forge.CreateRepoOptions) error {
 	url := "https://api.github.com/user/repos"
-	body, err := json.Marshal(req)
+	if c.owner != "" && !strings.EqualFold(c.owner, c.username) {
+		url = fmt.Sprintf("https://api.github.com/orgs/%s/repos", c.owner)
+	}
+	body, err := json.Marshal(CreateRepoRequest{
+		Name:        opts.Name,
+		Description: opts.Description,
+		Private:     opts.Private,
+		AutoInit:    false,
+	})
 	if err != nil {
 		return err
 	}
 
-	httpReq, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
 	if err != nil {
 		return err
 	}
@@ -72,9 +143,226 @@ func (c *Client) CreateRepo(req CreateRepoRequest) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 201 {
-		respBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to create repo (status %d): %s", resp.StatusCode, respBody)
+		return apierror.New(platform, "create repo", resp)
+	}
+
+	return nil
+}
+
+// DeleteRepo deletes a repository. The token needs the delete_repo scope.
+func (c *Client) DeleteRepo(ctx context.Context, owner, repo string) error {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/%s", owner, repo)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "token "+c.token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 204 {
+		return apierror.New(platform, "delete repo", resp)
 	}
 
 	return nil
 }
+
+type repository struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Private     bool   `json:"private"`
+	Fork        bool   `json:"fork"`
+	Archived    bool   `json:"archived"`
+	CloneURL    string `json:"clone_url"`
+}
+
+// GetRepo returns the settings of a repository.
+func (c *Client) GetRepo(ctx context.Context, owner, repo string) (*forge.RemoteRepo, error) {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/%s", owner, repo)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "token "+c.token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, apierror.New(platform, "get repo", resp)
+	}
+
+	var r repository
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("failed to decode repo: %w", err)
+	}
+	return &forge.RemoteRepo{
+		Name:        r.Name,
+		Description: r.Description,
+		Private:     r.Private,
+		Fork:        r.Fork,
+		Archived:    r.Archived,
+		CloneURL:    r.CloneURL,
+	}, nil
+}
+
+// editRepoRequest is the body of PATCH /repos/{owner}/{repo}.
+type editRepoRequest struct {
+	Description *string `json:"description,omitempty"`
+	Private     *bool   `json:"private,omitempty"`
+}
+
+// EditRepo changes the visibility or description of a repository.
+func (c *Client) EditRepo(ctx context.Context, owner, repo string, opts forge.EditRepoOptions) error {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/%s", owner, repo)
+	body, err := json.Marshal(editRepoRequest{
+		Description: opts.Description,
+		Private:     opts.Private,
+	})
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "PATCH", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Authorization", "token "+c.token)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return apierror.New(platform, "edit repo", resp)
+	}
+
+	return nil
+}
+
+// ListRepos returns the repositories owned by a user or organization. The
+// private repositories of the authenticated user are included.
+func (c *Client) ListRepos(ctx context.Context, owner string, org bool) ([]forge.RemoteRepo, error) {
+	const perPage = 100
+	var listURL string
+	switch {
+	case org:
+		listURL = fmt.Sprintf("https://api.github.com/orgs/%s/repos?type=all", owner)
+	case strings.EqualFold(owner, c.username):
+		// /users/{user}/repos only lists public repositories
+		listURL = "https://api.github.com/user/repos?affiliation=owner"
+	default:
+		listURL = fmt.Sprintf("https://api.github.com/users/%s/repos?type=owner", owner)
+	}
+
+	var repos []forge.RemoteRepo
+	for page := 1; ; page++ {
+		req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s&per_page=%d&page=%d", listURL, perPage, page), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "token "+c.token)
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != 200 {
+			err := apierror.New(platform, "list repos", resp)
+			resp.Body.Close()
+			return nil, err
+		}
+
+		var batch []repository
+		err = json.NewDecoder(resp.Body).Decode(&batch)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode repos: %w", err)
+		}
+
+		for _, r := range batch {
+			repos = append(repos, forge.RemoteRepo{
+				Name:        r.Name,
+				Description: r.Description,
+				Private:     r.Private,
+				Fork:        r.Fork,
+				Archived:    r.Archived,
+				CloneURL:    r.CloneURL,
+			})
+		}
+		if len(batch) < perPage {
+			return repos, nil
+		}
+	}
+}
+
+// TokenURL returns the page where personal access tokens are created.
+func (c *Client) TokenURL() string {
+	return "https://github.com/settings/tokens"
+}
+
+// Account returns the user of the token. Classic tokens report their scopes
+// in X-OAuth-Scopes; fine-grained tokens report none.
+func (c *Client) Account(ctx context.Context) (*forge.Account, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://api.github.com/user", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "token "+c.token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, apierror.New(platform, "get user", resp)
+	}
+
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return nil, fmt.Errorf("failed to decode user: %w", err)
+	}
+
+	account := &forge.Account{Username: user.Login}
+	if values, ok := resp.Header["X-Oauth-Scopes"]; ok {
+		account.Scopes = []string{}
+		for _, value := range values {
+			for _, scope := range strings.Split(value, ",") {
+				if scope = strings.TrimSpace(scope); scope != "" {
+					account.Scopes = append(account.Scopes, scope)
+				}
+			}
+		}
+		// public_repo is not enough for private repositories
+		if !slices.Contains(account.Scopes, "repo") {
+			account.Missing = append(account.Missing, "repo")
+		}
+		if !slices.Contains(account.Scopes, "delete_repo") {
+			account.MissingOptional = map[string]string{"delete_repo": "--rollback"}
+		}
+	}
+	if value := resp.Header.Get("GitHub-Authentication-Token-Expiration"); value != "" {
+		for _, layout := range []string{"2006-01-02 15:04:05 MST", "2006-01-02 15:04:05 -0700"} {
+			if expires, err := time.Parse(layout, value); err == nil {
+				account.Expires = expires
+				break
+			}
+		}
+	}
+	return account, nil
+}
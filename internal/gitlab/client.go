@@ -2,42 +2,135 @@ package gitlab
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Papiermond/gitea-sync/internal/apierror"
+	"github.com/Papiermond/gitea-sync/internal/config"
+	"github.com/Papiermond/gitea-sync/internal/forge"
 )
 
+// platform names the forge in API errors.
+const platform = "GitLab"
+
 type Client struct {
-	url    string
-	token  string
+	url      string
+	token    string
+	username string
+	// owner is the path of the group the repositories are created in, or
+	// "" for the user's own namespace.
+	owner  string
 	client *http.Client
 }
 
 type CreateRepoRequest struct {
-	Name       string `json:"name"`
-	Visibility string `json:"visibility"` // "private" or "public"
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Visibility  string `json:"visibility"` // "private" or "public"
+	// NamespaceID is the group to create the project in. Zero means the
+	// namespace of the user.
+	NamespaceID int `json:"namespace_id,omitempty"`
+}
+
+func init() {
+	forge.Register("gitlab", func(cfg *config.Config, httpClient *http.Client) (forge.Provider, error) {
+		if !cfg.GitLab.IsSet() || cfg.GitLab.Username == "" {
+			return nil, fmt.Errorf("GitLab credentials not configured. Run 'gitea-sync init' to configure")
+		}
+		baseURL := cfg.GitLab.URL
+		if baseURL != "" {
+			endpoint, err := config.ParseEndpoint(baseURL)
+			if err != nil {
+				return nil, fmt.Errorf("gitlab.url: %w", err)
+			}
+			baseURL = endpoint.BaseURL()
+		}
+		token, err := cfg.GitLab.Resolve("gitlab")
+		if err != nil {
+			return nil, err
+		}
+		client := NewClient(baseURL, token, cfg.GitLab.Username, httpClient)
+		client.owner = strings.Trim(cfg.GitLab.Owner, "/")
+		return client, nil
+	})
 }
 
-func NewClient(baseURL, token string) *Client {
+// NewClient returns a GitLab client. A nil httpClient uses a default client.
+func NewClient(baseURL, token, username string, httpClient *http.Client) *Client {
 	// Default to gitlab.com if no URL provided
 	if baseURL == "" {
 		baseURL = "https://gitlab.com"
 	}
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
 	return &Client{
-		url:    baseURL,
-		token:  token,
-		client: &http.Client{},
+		url:      baseURL,
+		token:    token,
+		username: username,
+		client:   httpClient,
 	}
 }
 
-func (c *Client) RepoExists(username, repo string) (bool, error) {
+func (c *Client) Name() string {
+	return "gitlab"
+}
+
+func (c *Client) DisplayName() string {
+	return "GitLab"
+}
+
+func (c *Client) CloneURL(owner, repo string) string {
+	return fmt.Sprintf("%s/%s/%s.git", c.url, owner, repo)
+}
+
+func (c *Client) WebURL(owner, repo string) string {
+	return fmt.Sprintf("%s/%s/%s", c.url, owner, repo)
+}
+
+func (c *Client) Credentials() (username, token string) {
+	return c.username, c.token
+}
+
+func (c *Client) Owner() string {
+	if c.owner != "" {
+		return c.owner
+	}
+	return c.username
+}
+
+// namespaceID returns the ID of the configured group, or 0 if the projects
+// belong to the user. Groups are looked up by their full path, so nested
+// subgroups such as "my-team/backend" work as well.
+func (c *Client) namespaceID(ctx context.Context) (int, error) {
+	if c.owner == "" || strings.EqualFold(c.owner, c.username) {
+		return 0, nil
+	}
+	var group struct {
+		ID int `json:"id"`
+	}
+	err := c.get(ctx, "/api/v4/groups/"+url.PathEscape(c.owner), "get group", &group)
+	if apierror.IsNotFound(err) {
+		return 0, fmt.Errorf("gitlab.owner: no GitLab group %q, or the token cannot see it", c.owner)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return group.ID, nil
+}
+
+func (c *Client) RepoExists(ctx context.Context, username, repo string) (bool, error) {
 	// GitLab uses namespace/project format
 	projectPath := url.PathEscape(fmt.Sprintf("%s/%s", username, repo))
 	apiURL := fmt.Sprintf("%s/api/v4/projects/%s", c.url, projectPath)
 
-	req, err := http.NewRequest("GET", apiURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
 	if err != nil {
 		return false, err
 	}
@@ -56,19 +149,33 @@ func (c *Client) RepoExists(username, repo string) (bool, error) {
 		return true, nil
 	}
 
-	body, _ := io.ReadAll(resp.Body)
-	return false, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, body)
+	return false, apierror.New(platform, "check repo", resp)
 }
 
-func (c *Client) CreateRepo(req CreateRepoRequest) error {
+// CreateRepo creates a project in the configured group, or in the user's
+// namespace if there is none.
+func (c *Client) CreateRepo(ctx context.Context, opts forge.CreateRepoOptions) error {
 	apiURL := fmt.Sprintf("%s/api/v4/projects", c.url)
 
-	body, err := json.Marshal(req)
+	namespaceID, err := c.namespaceID(ctx)
+	if err != nil {
+		return err
+	}
+	visibility := "public"
+	if opts.Private {
+		visibility = "private"
+	}
+	body, err := json.Marshal(CreateRepoRequest{
+		Name:        opts.Name,
+		Description: opts.Description,
+		Visibility:  visibility,
+		NamespaceID: namespaceID,
+	})
 	if err != nil {
 		return err
 	}
 
-	httpReq, err := http.NewRequest("POST", apiURL, bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewReader(body))
 	if err != nil {
 		return err
 	}
@@ -82,9 +189,223 @@ func (c *Client) CreateRepo(req CreateRepoRequest) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 201 {
-		respBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to create repo (status %d): %s", resp.StatusCode, respBody)
+		return apierror.New(platform, "create repo", resp)
 	}
 
 	return nil
 }
+
+// DeleteRepo deletes a project. GitLab answers 202 as the deletion runs in
+// the background, or may be delayed by the instance's deletion settings.
+func (c *Client) DeleteRepo(ctx context.Context, owner, repo string) error {
+	projectPath := url.PathEscape(fmt.Sprintf("%s/%s", owner, repo))
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s", c.url, projectPath)
+
+	req, err := http.NewRequestWithContext(ctx, "DELETE", apiURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("PRIVATE-TOKEN", c.token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 202 && resp.StatusCode != 204 {
+		return apierror.New(platform, "delete project", resp)
+	}
+
+	return nil
+}
+
+type project struct {
+	Path              string          `json:"path"`
+	Description       string          `json:"description"`
+	Visibility        string          `json:"visibility"`
+	Archived          bool            `json:"archived"`
+	ForkedFromProject json.RawMessage `json:"forked_from_project"`
+	HTTPURLToRepo     string          `json:"http_url_to_repo"`
+}
+
+// GetRepo returns the settings of a project. Internal projects count as
+// private.
+func (c *Client) GetRepo(ctx context.Context, owner, repo string) (*forge.RemoteRepo, error) {
+	projectPath := url.PathEscape(fmt.Sprintf("%s/%s", owner, repo))
+	var p project
+	if err := c.get(ctx, "/api/v4/projects/"+projectPath, "get project", &p); err != nil {
+		return nil, err
+	}
+	return &forge.RemoteRepo{
+		Name:        p.Path,
+		Description: p.Description,
+		Private:     p.Visibility != "public",
+		Fork:        len(p.ForkedFromProject) > 0 && string(p.ForkedFromProject) != "null",
+		Archived:    p.Archived,
+		CloneURL:    p.HTTPURLToRepo,
+	}, nil
+}
+
+// editProjectRequest is the body of PUT /projects/{id}.
+type editProjectRequest struct {
+	Description *string `json:"description,omitempty"`
+	Visibility  string  `json:"visibility,omitempty"`
+}
+
+// EditRepo changes the visibility or description of a project.
+func (c *Client) EditRepo(ctx context.Context, owner, repo string, opts forge.EditRepoOptions) error {
+	projectPath := url.PathEscape(fmt.Sprintf("%s/%s", owner, repo))
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s", c.url, projectPath)
+
+	req := editProjectRequest{Description: opts.Description}
+	if opts.Private != nil {
+		req.Visibility = "public"
+		if *opts.Private {
+			req.Visibility = "private"
+		}
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "PUT", apiURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("PRIVATE-TOKEN", c.token)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return apierror.New(platform, "edit project", resp)
+	}
+
+	return nil
+}
+
+// ListRepos returns the projects owned by a user, or by a group including
+// its subgroups. Internal projects count as private.
+func (c *Client) ListRepos(ctx context.Context, owner string, org bool) ([]forge.RemoteRepo, error) {
+	const perPage = 100
+	// The user endpoint only lists the user's own namespace already
+	listURL := fmt.Sprintf("%s/api/v4/users/%s/projects?", c.url, url.PathEscape(owner))
+	if org {
+		listURL = fmt.Sprintf("%s/api/v4/groups/%s/projects?include_subgroups=true&", c.url, url.PathEscape(owner))
+	}
+
+	var repos []forge.RemoteRepo
+	for page := 1; ; page++ {
+		req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%sper_page=%d&page=%d", listURL, perPage, page), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("PRIVATE-TOKEN", c.token)
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != 200 {
+			err := apierror.New(platform, "list projects", resp)
+			resp.Body.Close()
+			return nil, err
+		}
+
+		var batch []project
+		err = json.NewDecoder(resp.Body).Decode(&batch)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode projects: %w", err)
+		}
+
+		for _, p := range batch {
+			repos = append(repos, forge.RemoteRepo{
+				Name:        p.Path,
+				Description: p.Description,
+				Private:     p.Visibility != "public",
+				Fork:        len(p.ForkedFromProject) > 0 && string(p.ForkedFromProject) != "null",
+				Archived:    p.Archived,
+				CloneURL:    p.HTTPURLToRepo,
+			})
+		}
+		if len(batch) < perPage {
+			return repos, nil
+		}
+	}
+}
+
+// TokenURL returns the page where personal access tokens are created.
+func (c *Client) TokenURL() string {
+	return c.url + "/-/user_settings/personal_access_tokens"
+}
+
+// Account returns the user of the token, with the scopes and expiry
+// reported by the token self endpoint of GitLab 15.5 and later.
+func (c *Client) Account(ctx context.Context) (*forge.Account, error) {
+	var user struct {
+		Username string `json:"username"`
+	}
+	if err := c.get(ctx, "/api/v4/user", "get user", &user); err != nil {
+		return nil, err
+	}
+	account := &forge.Account{Username: user.Username}
+
+	var token struct {
+		Scopes    []string `json:"scopes"`
+		ExpiresAt string   `json:"expires_at"`
+	}
+	err := c.get(ctx, "/api/v4/personal_access_tokens/self", "get token", &token)
+	if apierror.IsNotFound(err) {
+		// Older GitLab versions do not report the scopes
+		return account, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	account.Scopes = token.Scopes
+	if account.Scopes == nil {
+		account.Scopes = []string{}
+	}
+	if !slices.Contains(account.Scopes, "api") {
+		account.Missing = append(account.Missing, "api")
+	}
+	if token.ExpiresAt != "" {
+		if expires, err := time.Parse(time.DateOnly, token.ExpiresAt); err == nil {
+			account.Expires = expires
+		}
+	}
+	return account, nil
+}
+
+// get decodes the JSON answer of a GET request to path into v.
+func (c *Client) get(ctx context.Context, path, action string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.url+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("PRIVATE-TOKEN", c.token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return apierror.New(platform, action, resp)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Papiermond/gitea-sync/internal/bulkfile"
+)
+
+// Entry states.
+const (
+	Pending = "pending"
+	Done    = "done"
+	Failed  = "failed"
+)
+
+// Gitea repository states of an entry.
+const (
+	RepoCreated = "created"
+	RepoExisted = "existed"
+)
+
+// MirrorConfigured is the mirror state of a target whose push mirror is set up.
+const MirrorConfigured = "configured"
+
+// Entry is the state of one repository of a bulk run.
+type Entry struct {
+	Repo   bulkfile.Entry `json:"repo"`
+	Status string         `json:"status"`
+	// GiteaRepo is RepoCreated or RepoExisted once the Gitea repository is
+	// in place.
+	GiteaRepo string `json:"gitea_repo,omitempty"`
+	// Mirrors maps target names to MirrorConfigured or the error of the
+	// push mirror setup.
+	Mirrors   map[string]string `json:"mirrors,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	UpdatedAt time.Time         `json:"updated_at,omitempty"`
+}
+
+// Incomplete reports whether the entry has to be processed again.
+func (e *Entry) Incomplete() bool {
+	return e.Status != Done
+}
+
+// Journal records the progress of a bulk run in a JSON file, which is
+// rewritten after every update so that an interrupted run can be resumed.
+type Journal struct {
+	Started time.Time `json:"started"`
+	// Targets are the --target flags of the run, used by entries that do
+	// not list their own targets.
+	Targets []string `json:"targets,omitempty"`
+	// Owner is the Gitea user or organization owning the repositories of
+	// the run. Journals of older versions leave it empty.
+	Owner   string   `json:"owner,omitempty"`
+	Entries []*Entry `json:"entries"`
+
+	path string
+	mu   sync.Mutex
+	err  error
+}
+
+// Dir returns the directory the journals are written to,
+// $XDG_STATE_HOME/gitea-sync/journal, with XDG_STATE_HOME defaulting to
+// ~/.local/state.
+func Dir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	dir := os.Getenv("XDG_STATE_HOME")
+	// The XDG spec asks to ignore relative paths
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "gitea-sync", "journal"), nil
+}
+
+// New returns a journal for a new run with all entries pending that is
+// kept in memory only.
+func New(entries []bulkfile.Entry, targets []string) *Journal {
+	j := &Journal{
+		Started: time.Now(),
+		Targets: targets,
+	}
+	for _, entry := range entries {
+		j.Entries = append(j.Entries, &Entry{Repo: entry, Status: Pending})
+	}
+	return j
+}
+
+// Create writes a journal returned by New to a new file in Dir.
+func (j *Journal) Create() error {
+	dir, err := Dir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.path = filepath.Join(dir, "bulk-"+j.Started.Format("20060102-150405.000")+".json")
+	return j.save()
+}
+
+// Load reads the journal at path. Updates are written back to it.
+func Load(path string) (*Journal, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{path: path}
+	if err := json.Unmarshal(data, j); err != nil {
+		return nil, fmt.Errorf("%s: invalid journal: %w", path, err)
+	}
+	return j, nil
+}
+
+// Latest returns the path of the most recent journal in Dir.
+func Latest() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "bulk-*.json"))
+	if err != nil {
+		return "", err
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("no bulk run journal found in %s", dir)
+	}
+	// The timestamps in the names sort chronologically
+	sort.Strings(names)
+	return names[len(names)-1], nil
+}
+
+// Path returns the file the journal is written to, or "" for a journal
+// kept in memory.
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Detach stops writing the journal to its file, e.g. for a dry run.
+func (j *Journal) Detach() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.path = ""
+}
+
+// Incomplete returns the entries that are pending or failed.
+func (j *Journal) Incomplete() []*Entry {
+	var entries []*Entry
+	for _, entry := range j.Entries {
+		if entry.Incomplete() {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Update applies fn to entry and writes the journal. It is safe for
+// concurrent use. A failed write is kept and returned by Err, so that it
+// does not fail the repository being processed.
+func (j *Journal) Update(entry *Entry, fn func(e *Entry)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	fn(entry)
+	entry.UpdatedAt = time.Now()
+	if err := j.save(); err != nil && j.err == nil {
+		j.err = err
+	}
+}
+
+// Err returns the first error writing the journal.
+func (j *Journal) Err() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.err
+}
+
+// save writes the journal to a temporary file and renames it over the
+// journal, so that an interrupted write never leaves a truncated journal.
+func (j *Journal) save() error {
+	if j.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), "."+strings.TrimSuffix(filepath.Base(j.path), ".json")+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), j.path)
+}
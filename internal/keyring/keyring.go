@@ -0,0 +1,217 @@
+// Package keyring stores tokens in the freedesktop Secret Service, e.g.
+// GNOME Keyring or KeePassXC, over the D-Bus session bus.
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Service is the "service" attribute of the items gitea-sync stores. The
+// "account" attribute tells them apart, so an item can be read with e.g.
+// "secret-tool lookup service gitea-sync account default/gitea".
+const Service = "gitea-sync"
+
+const (
+	serviceName     = "org.freedesktop.secrets"
+	servicePath     = dbus.ObjectPath("/org/freedesktop/secrets")
+	defaultAlias    = dbus.ObjectPath("/org/freedesktop/secrets/aliases/default")
+	serviceIface    = "org.freedesktop.Secret.Service"
+	collectionIface = "org.freedesktop.Secret.Collection"
+	itemIface       = "org.freedesktop.Secret.Item"
+	sessionIface    = "org.freedesktop.Secret.Session"
+	promptIface     = "org.freedesktop.Secret.Prompt"
+	noPrompt        = dbus.ObjectPath("/")
+	plainAlgorithm  = "plain"
+)
+
+// ErrNotFound is returned by Get if no item matches the account.
+var ErrNotFound = errors.New("no such secret in the keyring")
+
+// secret is the Secret struct of the Secret Service API.
+type secret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// keyring is a session with the Secret Service.
+type keyring struct {
+	conn    *dbus.Conn
+	service dbus.BusObject
+	session dbus.ObjectPath
+}
+
+// open connects to the session bus and opens a session that transfers
+// secrets unencrypted. The bus is private to the user, so encrypting the
+// transfer would not protect against anyone who can read it.
+func open() (*keyring, error) {
+	address, err := sessionBusAddress()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to the D-Bus session bus: %w", err)
+	}
+	k := &keyring{conn: conn, service: conn.Object(serviceName, servicePath)}
+
+	var output dbus.Variant
+	err = k.service.Call(serviceIface+".OpenSession", 0, plainAlgorithm, dbus.MakeVariant("")).Store(&output, &k.session)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("no Secret Service available: %w", err)
+	}
+	return k, nil
+}
+
+func (k *keyring) close() {
+	k.conn.Object(serviceName, k.session).Call(sessionIface+".Close", 0)
+	k.conn.Close()
+}
+
+// Available reports whether a Secret Service is running on the session bus.
+func Available() bool {
+	k, err := open()
+	if err != nil {
+		return false
+	}
+	k.close()
+	return true
+}
+
+// Get returns the secret stored for account.
+func Get(account string) (string, error) {
+	k, err := open()
+	if err != nil {
+		return "", err
+	}
+	defer k.close()
+
+	var unlocked, locked []dbus.ObjectPath
+	err = k.service.Call(serviceIface+".SearchItems", 0, attributes(account)).Store(&unlocked, &locked)
+	if err != nil {
+		return "", fmt.Errorf("failed to search the keyring: %w", err)
+	}
+	if len(unlocked) == 0 && len(locked) > 0 {
+		if unlocked, err = k.unlock(locked); err != nil {
+			return "", err
+		}
+	}
+	if len(unlocked) == 0 {
+		return "", ErrNotFound
+	}
+
+	var s secret
+	if err := k.conn.Object(serviceName, unlocked[0]).Call(itemIface+".GetSecret", 0, k.session).Store(&s); err != nil {
+		return "", fmt.Errorf("failed to read the secret: %w", err)
+	}
+	return string(s.Value), nil
+}
+
+// Set stores value for account in the default collection, replacing an
+// earlier secret of the account. The label is shown by keyring managers.
+func Set(account, label, value string) error {
+	k, err := open()
+	if err != nil {
+		return err
+	}
+	defer k.close()
+
+	if _, err := k.unlock([]dbus.ObjectPath{defaultAlias}); err != nil {
+		return err
+	}
+
+	properties := map[string]dbus.Variant{
+		itemIface + ".Label":      dbus.MakeVariant(label),
+		itemIface + ".Attributes": dbus.MakeVariant(attributes(account)),
+	}
+	s := secret{Session: k.session, Value: []byte(value), ContentType: "text/plain"}
+	var item, prompt dbus.ObjectPath
+	err = k.conn.Object(serviceName, defaultAlias).Call(collectionIface+".CreateItem", 0, properties, s, true).Store(&item, &prompt)
+	if err != nil {
+		return fmt.Errorf("failed to store the secret: %w", err)
+	}
+	if prompt != noPrompt {
+		if _, err := k.prompt(prompt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unlock unlocks objects, asking the user for the keyring password if the
+// Secret Service needs it, and returns the unlocked objects.
+func (k *keyring) unlock(objects []dbus.ObjectPath) ([]dbus.ObjectPath, error) {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	if err := k.service.Call(serviceIface+".Unlock", 0, objects).Store(&unlocked, &prompt); err != nil {
+		return nil, fmt.Errorf("failed to unlock the keyring: %w", err)
+	}
+	if prompt == noPrompt {
+		return unlocked, nil
+	}
+
+	result, err := k.prompt(prompt)
+	if err != nil {
+		return nil, err
+	}
+	if paths, ok := result.Value().([]dbus.ObjectPath); ok {
+		unlocked = paths
+	}
+	return unlocked, nil
+}
+
+// prompt shows a prompt of the Secret Service, e.g. for the keyring
+// password, and returns its result once the user completed it.
+func (k *keyring) prompt(path dbus.ObjectPath) (dbus.Variant, error) {
+	match := []dbus.MatchOption{dbus.WithMatchObjectPath(path), dbus.WithMatchInterface(promptIface), dbus.WithMatchMember("Completed")}
+	if err := k.conn.AddMatchSignal(match...); err != nil {
+		return dbus.Variant{}, fmt.Errorf("failed to watch the keyring prompt: %w", err)
+	}
+	defer k.conn.RemoveMatchSignal(match...)
+
+	signals := make(chan *dbus.Signal, 1)
+	k.conn.Signal(signals)
+	defer k.conn.RemoveSignal(signals)
+
+	if err := k.conn.Object(serviceName, path).Call(promptIface+".Prompt", 0, "").Err; err != nil {
+		return dbus.Variant{}, fmt.Errorf("failed to show the keyring prompt: %w", err)
+	}
+	for signal := range signals {
+		if signal.Path != path || signal.Name != promptIface+".Completed" || len(signal.Body) != 2 {
+			continue
+		}
+		if dismissed, _ := signal.Body[0].(bool); dismissed {
+			return dbus.Variant{}, fmt.Errorf("keyring prompt dismissed")
+		}
+		result, _ := signal.Body[1].(dbus.Variant)
+		return result, nil
+	}
+	return dbus.Variant{}, fmt.Errorf("keyring connection closed")
+}
+
+// sessionBusAddress returns the address of the session bus. Unlike
+// dbus.ConnectSessionBus, it never launches a bus if there is none.
+func sessionBusAddress() (string, error) {
+	if address := os.Getenv("DBUS_SESSION_BUS_ADDRESS"); address != "" {
+		return address, nil
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		path := filepath.Join(dir, "bus")
+		if _, err := os.Stat(path); err == nil {
+			return "unix:path=" + path, nil
+		}
+	}
+	return "", errors.New("no D-Bus session bus found (DBUS_SESSION_BUS_ADDRESS is not set)")
+}
+
+// attributes returns the lookup attributes of the item of account.
+func attributes(account string) map[string]string {
+	return map[string]string{"service": Service, "account": account}
+}
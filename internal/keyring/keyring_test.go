@@ -0,0 +1,193 @@
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// fakeService is a minimal Secret Service: it keeps the items of the
+// default collection in memory, never locks them and never prompts.
+type fakeService struct {
+	conn  *dbus.Conn
+	mu    sync.Mutex
+	items map[dbus.ObjectPath]*fakeItem
+	next  int
+}
+
+type fakeItem struct {
+	attributes map[string]string
+	value      []byte
+}
+
+// fakeCollection and fakeItemObject export the collection and item
+// methods of fakeService under their own interfaces.
+type fakeCollection struct{ s *fakeService }
+
+type fakeItemObject struct {
+	s    *fakeService
+	path dbus.ObjectPath
+}
+
+func (s *fakeService) OpenSession(algorithm string, input dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	if algorithm != plainAlgorithm {
+		return dbus.Variant{}, "", dbus.MakeFailedError(fmt.Errorf("unsupported algorithm %q", algorithm))
+	}
+	return dbus.MakeVariant(""), "/org/freedesktop/secrets/session/1", nil
+}
+
+func (s *fakeService) SearchItems(attributes map[string]string) ([]dbus.ObjectPath, []dbus.ObjectPath, *dbus.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var unlocked []dbus.ObjectPath
+	for path, item := range s.items {
+		if maps.Equal(item.attributes, attributes) {
+			unlocked = append(unlocked, path)
+		}
+	}
+	return unlocked, []dbus.ObjectPath{}, nil
+}
+
+func (s *fakeService) Unlock(objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	return objects, noPrompt, nil
+}
+
+func (s *fakeService) Close() *dbus.Error {
+	return nil
+}
+
+func (c fakeCollection) CreateItem(properties map[string]dbus.Variant, value secret, replace bool) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	attributes, ok := properties[itemIface+".Attributes"].Value().(map[string]string)
+	if !ok {
+		return "", "", dbus.MakeFailedError(errors.New("missing attributes"))
+	}
+
+	s := c.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if replace {
+		for path, item := range s.items {
+			if maps.Equal(item.attributes, attributes) {
+				item.value = value.Value
+				return path, noPrompt, nil
+			}
+		}
+	}
+	s.next++
+	path := dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/secrets/collection/login/%d", s.next))
+	s.items[path] = &fakeItem{attributes: attributes, value: value.Value}
+	if err := s.conn.Export(fakeItemObject{s: s, path: path}, path, itemIface); err != nil {
+		return "", "", dbus.MakeFailedError(err)
+	}
+	return path, noPrompt, nil
+}
+
+func (o fakeItemObject) GetSecret(session dbus.ObjectPath) (secret, *dbus.Error) {
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+	item, ok := o.s.items[o.path]
+	if !ok {
+		return secret{}, dbus.MakeFailedError(errors.New("no such item"))
+	}
+	return secret{Session: session, Value: item.value, ContentType: "text/plain"}, nil
+}
+
+// startSecretService runs a private session bus with a fakeService on it
+// and points DBUS_SESSION_BUS_ADDRESS at it for the rest of the test.
+func startSecretService(t *testing.T) {
+	t.Helper()
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not installed")
+	}
+
+	address := "unix:path=" + filepath.Join(t.TempDir(), "bus")
+	bus := exec.Command(daemon, "--session", "--nofork", "--address="+address)
+	if err := bus.Start(); err != nil {
+		t.Fatalf("failed to start dbus-daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		bus.Process.Kill()
+		bus.Wait()
+	})
+
+	var conn *dbus.Conn
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if conn, err = dbus.Connect(address); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("failed to connect to the test bus: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	s := &fakeService{conn: conn, items: make(map[dbus.ObjectPath]*fakeItem)}
+	if err := conn.Export(s, servicePath, serviceIface); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Export(s, "/org/freedesktop/secrets/session/1", sessionIface); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Export(fakeCollection{s: s}, defaultAlias, collectionIface); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := conn.RequestName(serviceName, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("failed to own %s: %v", serviceName, err)
+	}
+
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", address)
+}
+
+func TestSecretService(t *testing.T) {
+	startSecretService(t)
+
+	if !Available() {
+		t.Fatal("Available() = false, want true")
+	}
+
+	if _, err := Get("default/gitea"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get before Set: err = %v, want ErrNotFound", err)
+	}
+
+	if err := Set("default/gitea", "gitea-sync default/gitea", "first"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if got, err := Get("default/gitea"); err != nil || got != "first" {
+		t.Fatalf("Get = %q, %v; want \"first\"", got, err)
+	}
+
+	// A second Set replaces the secret of the account
+	if err := Set("default/gitea", "gitea-sync default/gitea", "second"); err != nil {
+		t.Fatalf("Set again: %v", err)
+	}
+	if got, err := Get("default/gitea"); err != nil || got != "second" {
+		t.Fatalf("Get after replacing = %q, %v; want \"second\"", got, err)
+	}
+
+	// Other accounts are not affected
+	if _, err := Get("work/gitea"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of another account: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestNoSessionBus(t *testing.T) {
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "")
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	if Available() {
+		t.Fatal("Available() = true without a session bus")
+	}
+	if err := Set("default/gitea", "label", "value"); err == nil {
+		t.Fatal("Set without a session bus succeeded")
+	}
+}
@@ -0,0 +1,98 @@
+package manifest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest is the declarative list of repositories kept in sync by
+// 'gitea-sync plan' and 'gitea-sync apply'.
+type Manifest struct {
+	Defaults Defaults `yaml:"defaults"`
+	Repos    []Repo   `yaml:"repos"`
+}
+
+// Defaults apply to every repository that does not set the field itself.
+type Defaults struct {
+	Visibility string   `yaml:"visibility"`
+	Targets    []string `yaml:"targets"`
+	Interval   string   `yaml:"interval"`
+}
+
+type Repo struct {
+	Name string `yaml:"name"`
+	// Visibility is "public" or "private". Empty leaves the visibility of
+	// existing repositories alone and creates public ones.
+	Visibility  string   `yaml:"visibility"`
+	Targets     []string `yaml:"targets"`
+	Interval    string   `yaml:"interval"`
+	Description string   `yaml:"description"`
+	// Topics are only managed when the key is present; an empty list
+	// removes all topics.
+	Topics []string `yaml:"topics"`
+}
+
+// Private reports whether the repository should be private.
+func (r Repo) Private() bool {
+	return r.Visibility == "private"
+}
+
+// Load reads the manifest at path, fills in defaults and validates it.
+func Load(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unknown keys, e.g. a misspelled visibility, are rejected instead of
+	// leaving the setting at its default
+	var m Manifest
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&m); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+	}
+
+	if m.Defaults.Interval == "" {
+		m.Defaults.Interval = "8h"
+	}
+
+	seen := make(map[string]bool)
+	for i := range m.Repos {
+		repo := &m.Repos[i]
+		if repo.Name == "" {
+			return nil, fmt.Errorf("repos[%d]: name is required", i)
+		}
+		if seen[repo.Name] {
+			return nil, fmt.Errorf("repos[%d]: duplicate repository %q", i, repo.Name)
+		}
+		seen[repo.Name] = true
+
+		if repo.Visibility == "" {
+			repo.Visibility = m.Defaults.Visibility
+		}
+		if repo.Targets == nil {
+			repo.Targets = m.Defaults.Targets
+		}
+		if repo.Interval == "" {
+			repo.Interval = m.Defaults.Interval
+		}
+
+		switch repo.Visibility {
+		case "", "public", "private":
+		default:
+			return nil, fmt.Errorf("repo %s: visibility must be \"public\" or \"private\", got %q", repo.Name, repo.Visibility)
+		}
+		if _, err := time.ParseDuration(repo.Interval); err != nil {
+			return nil, fmt.Errorf("repo %s: invalid interval %q: %w", repo.Name, repo.Interval, err)
+		}
+	}
+
+	return &m, nil
+}
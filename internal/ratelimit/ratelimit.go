@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMaxRetries = 5
+	defaultMaxWait    = 10 * time.Minute
+	fallbackWait      = 5 * time.Second
+)
+
+// Transport retries requests rejected by a rate limit, waiting as long as
+// the server asks for through Retry-After, X-RateLimit-Reset (GitHub) or
+// RateLimit-Reset (GitLab) before each retry.
+type Transport struct {
+	// Base performs the requests. Nil means http.DefaultTransport.
+	Base http.RoundTripper
+	// MaxRetries limits the retries per request. Zero means 5.
+	MaxRetries int
+	// MaxWait is the longest single wait. A rate limit that resets later
+	// than that is returned to the caller. Zero means 10 minutes.
+	MaxWait time.Duration
+	// OnWait, if set, is called before waiting for a rate limit.
+	OnWait func(req *http.Request, wait time.Duration)
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	maxRetries := t.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = defaultMaxRetries
+	}
+	maxWait := t.MaxWait
+	if maxWait == 0 {
+		maxWait = defaultMaxWait
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := base.RoundTrip(req)
+		if err != nil || !isRateLimited(resp) {
+			return resp, err
+		}
+
+		// A request body can only be sent again if it can be recreated
+		if attempt >= maxRetries || (req.Body != nil && req.GetBody == nil) {
+			return resp, nil
+		}
+
+		wait := retryAfter(resp, time.Now(), attempt)
+		if wait > maxWait {
+			return resp, nil
+		}
+
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		if t.OnWait != nil {
+			t.OnWait(req, wait)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// isRateLimited reports whether resp is a rate limit rejection. GitHub
+// answers 403 for both its primary limit (remaining quota of zero) and its
+// secondary limits (mentioned in the message).
+func isRateLimited(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		return false
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" || resp.Header.Get("Retry-After") != "" {
+		return true
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return err == nil && strings.Contains(strings.ToLower(string(body)), "secondary rate limit")
+}
+
+// retryAfter returns how long to wait before retrying, preferring the
+// server's hints and falling back to exponential backoff.
+func retryAfter(resp *http.Response, now time.Time, attempt int) time.Duration {
+	if value := resp.Header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		if at, err := http.ParseTime(value); err == nil {
+			return nonNegative(at.Sub(now))
+		}
+	}
+
+	for _, header := range []string{"X-RateLimit-Reset", "RateLimit-Reset"} {
+		if value := resp.Header.Get(header); value != "" {
+			if epoch, err := strconv.ParseInt(value, 10, 64); err == nil {
+				// Add a second as the reset time is truncated
+				return nonNegative(time.Unix(epoch, 0).Sub(now)) + time.Second
+			}
+		}
+	}
+
+	return fallbackWait << attempt
+}
+
+func nonNegative(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
@@ -0,0 +1,125 @@
+package retry
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+const defaultBackoff = time.Second
+
+// Transport limits every request attempt to Timeout and retries idempotent
+// requests (GET, HEAD, OPTIONS) that fail with a network error, a timeout
+// or a 502, 503 or 504 status, waiting exponentially longer before each
+// retry. Writes are never retried, as they may have reached the server.
+type Transport struct {
+	// Base performs the requests. Nil means http.DefaultTransport.
+	Base http.RoundTripper
+	// Retries limits the retries per request.
+	Retries int
+	// Timeout limits each attempt, including reading the response body.
+	// Zero means no limit.
+	Timeout time.Duration
+	// Backoff is the wait before the first retry, doubled for every further
+	// retry. Zero means one second.
+	Backoff time.Duration
+	// OnRetry, if set, is called before waiting for a retry with the reason
+	// of the failed attempt: an error, or a response with its status.
+	OnRetry func(req *http.Request, wait time.Duration, resp *http.Response, err error)
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	backoff := t.Backoff
+	if backoff == 0 {
+		backoff = defaultBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := t.attempt(base, req)
+		if !idempotent(req) || attempt >= t.Retries || !retryable(resp, err) {
+			return resp, err
+		}
+		// The caller gave up, e.g. on Ctrl+C
+		if req.Context().Err() != nil {
+			return resp, err
+		}
+
+		wait := backoff << attempt
+		if t.OnRetry != nil {
+			t.OnRetry(req, wait, resp, err)
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends req once, limited to Timeout. The timeout stays in effect
+// until the response body is closed.
+func (t *Transport) attempt(base http.RoundTripper, req *http.Request) (*http.Response, error) {
+	if t.Timeout == 0 {
+		return base.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), t.Timeout)
+	resp, err := base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody releases the timeout of an attempt when the body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// idempotent reports whether req can be sent again. Requests with a body
+// are not, as the body has been consumed.
+func idempotent(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody {
+		return false
+	}
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS":
+		return true
+	}
+	return false
+}
+
+// retryable reports whether a failed attempt is worth retrying. Network
+// errors and timeouts of the attempt are; 4xx and other 5xx statuses are
+// answers that a retry would not change.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}